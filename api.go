@@ -0,0 +1,158 @@
+// Copyright 2020 CIS Maxwell, LLC. All rights reserved.
+// Copyright 2020 The Calyx Institute
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"gitlab.com/calyxos/device-flasher/device"
+	"gitlab.com/calyxos/device-flasher/station"
+)
+
+// api serves the station to other programs as JSON:
+//
+//	GET  /api/devices           attached devices, with the factory image matching them
+//	GET  /api/images            factory images by codename
+//	GET  /api/jobs              every job, oldest first
+//	POST /api/jobs              start a job: {"serial": "...", "asset_tag": "...", "skip_lock": false, "timeout": 3600}
+//	GET  /api/jobs/{id}         a job
+//	GET  /api/jobs/{id}/log     its log as text
+//	POST /api/jobs/{id}/cancel  stop it
+//
+// Errors come back as {"error": "..."}.
+func (w *web) api() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/devices", func(rw http.ResponseWriter, r *http.Request) {
+		type match struct {
+			*device.Device
+			AssetTag string `json:"asset_tag,omitempty"`
+			Factory  string `json:"factory,omitempty"`
+		}
+		matches := []match{}
+		for _, d := range w.station.Devices() {
+			matches = append(matches, match{d, w.station.Tag(d.Serial), w.station.Flasher.Images[d.Codename]})
+		}
+		writeJSON(rw, http.StatusOK, matches)
+	})
+	mux.HandleFunc("/api/images", func(rw http.ResponseWriter, r *http.Request) {
+		writeJSON(rw, http.StatusOK, w.station.Flasher.Images)
+	})
+	mux.HandleFunc("/api/jobs", func(rw http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			writeJSON(rw, http.StatusOK, w.station.Jobs())
+		case http.MethodPost:
+			var request struct {
+				Serial string `json:"serial"`
+				station.Options
+			}
+			if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+				writeError(rw, http.StatusBadRequest, err.Error())
+				return
+			}
+			job, err := w.station.Start(request.Serial, request.Options)
+			if err != nil {
+				writeError(rw, http.StatusBadRequest, err.Error())
+				return
+			}
+			writeJSON(rw, http.StatusCreated, job)
+		default:
+			writeError(rw, http.StatusMethodNotAllowed, "method not allowed")
+		}
+	})
+	mux.HandleFunc("/api/jobs/", func(rw http.ResponseWriter, r *http.Request) {
+		// /api/jobs/{id} or /api/jobs/{id}/{action}
+		path := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/api/jobs/"), "/", 2)
+		id, action := path[0], ""
+		if len(path) > 1 {
+			action = path[1]
+		}
+		job, ok := w.station.Job(id)
+		if !ok || (action != "" && action != "log" && action != "cancel") {
+			writeError(rw, http.StatusNotFound, "not found")
+			return
+		}
+		switch {
+		case action == "" && r.Method == http.MethodGet:
+			writeJSON(rw, http.StatusOK, job)
+		case action == "log" && r.Method == http.MethodGet:
+			log, _ := w.station.Log(id)
+			rw.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			_, _ = rw.Write(log)
+		case action == "cancel" && r.Method == http.MethodPost:
+			_ = w.station.Cancel(id)
+			rw.WriteHeader(http.StatusNoContent)
+		default:
+			writeError(rw, http.StatusMethodNotAllowed, "method not allowed")
+		}
+	})
+	return mux
+}
+
+// tokenCookie keeps the token in the browser once the page was opened with
+// ?token=<token>, so that its buttons and events carry it too.
+const tokenCookie = "device-flasher-token"
+
+// authorize lets requests through if there is no token, or if they carry it
+// as "Authorization: Bearer <token>", in the token cookie or as the token
+// query parameter. The query parameter sets the cookie.
+func (w *web) authorize(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if w.token == "" {
+			next.ServeHTTP(rw, r)
+			return
+		}
+		if given := r.URL.Query().Get("token"); given != "" && w.valid(given) {
+			http.SetCookie(rw, &http.Cookie{
+				Name:     tokenCookie,
+				Value:    given,
+				Path:     "/",
+				HttpOnly: true,
+				SameSite: http.SameSiteStrictMode,
+			})
+			next.ServeHTTP(rw, r)
+			return
+		}
+		if cookie, err := r.Cookie(tokenCookie); err == nil && w.valid(cookie.Value) {
+			next.ServeHTTP(rw, r)
+			return
+		}
+		if header := r.Header.Get("Authorization"); strings.HasPrefix(header, "Bearer ") && w.valid(strings.TrimPrefix(header, "Bearer ")) {
+			next.ServeHTTP(rw, r)
+			return
+		}
+		writeError(rw, http.StatusUnauthorized, "unauthorized")
+	})
+}
+
+func (w *web) valid(given string) bool {
+	return subtle.ConstantTimeCompare([]byte(given), []byte(w.token)) == 1
+}
+
+func writeJSON(rw http.ResponseWriter, status int, v interface{}) {
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(status)
+	enc := json.NewEncoder(rw)
+	enc.SetIndent("", "  ")
+	_ = enc.Encode(v)
+}
+
+func writeError(rw http.ResponseWriter, status int, message string) {
+	writeJSON(rw, status, map[string]string{"error": message})
+}
@@ -0,0 +1,190 @@
+// Copyright 2020 CIS Maxwell, LLC. All rights reserved.
+// Copyright 2020 The Calyx Institute
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	"gitlab.com/calyxos/device-flasher/bundle"
+	"gitlab.com/calyxos/device-flasher/factory"
+	"gitlab.com/calyxos/device-flasher/internal/humanize"
+	"gitlab.com/calyxos/device-flasher/platformtools"
+)
+
+// offline is the manifest of the bundle the flasher was extracted from, if
+// any. The flasher then takes its images and platform tools from the bundle
+// and does not download anything.
+var offline *bundle.Manifest
+
+// openBundle recognizes a bundle extracted around the flasher.
+func openBundle() {
+	m, err := bundle.Open(cwd)
+	if os.IsNotExist(err) {
+		return
+	}
+	if err != nil {
+		errorln(err, true)
+	}
+	offline = m
+}
+
+// defaultImagesDir returns the images folder of the bundle, or the folder of the flasher.
+func defaultImagesDir() string {
+	if offline != nil {
+		return bundle.Folder(cwd, bundle.FactoryImage)
+	}
+	return cwd
+}
+
+// checkBundle makes sure that the factory images taken from the bundle are
+// the ones in its manifest, and refuses the ones it does not list. The sums
+// are kept in the cache, so that each image is only hashed once.
+func checkBundle(o *options, images map[string]string) error {
+	if offline == nil {
+		return nil
+	}
+	for _, image := range images {
+		expected := offline.SHA256(cwd, image)
+		if expected == "" {
+			return errors.New(tr("%s is not in the manifest of the bundle", filepath.Base(image)))
+		}
+		sum, err := o.cache().SHA256(image)
+		if err != nil {
+			return err
+		}
+		if sum != expected {
+			return errors.New(tr("%s does not match the manifest of the bundle", filepath.Base(image)))
+		}
+	}
+	return nil
+}
+
+// flasherNames are the names of the flasher for each OS, as built by make
+// and as released.
+var flasherNames = map[string][]string{
+	"darwin":  {"device-flasher.darwin", "CalyxOS-flasher_darwin"},
+	"linux":   {"device-flasher.linux", "CalyxOS-flasher_linux"},
+	"windows": {"device-flasher.exe", "CalyxOS-flasher_windows.exe"},
+}
+
+// flasherBinary returns the flasher for goos in dir, the running one if there
+// is none for its own OS, or "", along with the name it goes by in a bundle.
+// The running one is renamed to the released name for its OS.
+func flasherBinary(dir, goos string) (file, name string) {
+	for _, name := range flasherNames[goos] {
+		file := filepath.Join(dir, name)
+		if info, err := os.Stat(file); err == nil && info.Mode().IsRegular() {
+			return file, name
+		}
+	}
+	if goos == runtime.GOOS {
+		names := flasherNames[goos]
+		return executable, names[len(names)-1]
+	}
+	return "", ""
+}
+
+func bundleCommand(o *options, args []string) {
+	if len(args) != 1 {
+		errorln(fmt.Errorf("expected %s bundle <bundle.zip>", program), true)
+	}
+	m := &bundle.Manifest{FlasherVersion: version, PlatformToolsVersion: platformtools.Version, Created: time.Now().UTC()}
+	images, err := findImages(o)
+	if err != nil {
+		errorln(err, true)
+	}
+	var codenames []string
+	for codename := range images {
+		codenames = append(codenames, codename)
+	}
+	sort.Strings(codenames)
+	var bundled int
+	for _, codename := range codenames {
+		image := images[codename]
+		if info, err := os.Stat(image); err != nil || info.IsDir() {
+			warnln(tr("%s is an extracted folder, only factory zips are bundled", filepath.Base(image)))
+			continue
+		}
+		report, err := factory.Validate(image)
+		if err == nil {
+			err = report.Err()
+		}
+		if err != nil {
+			errorln(err, true)
+		}
+		fmt.Println(tr("Verifying %s", filepath.Base(image)))
+		if err := factory.Verify(image); err != nil {
+			errorln(filepath.Base(image)+": "+err.Error(), true)
+		}
+		m.Add(bundle.FactoryImage, image, bundle.File{Codename: codename})
+		for _, ext := range []string{".sha256", ".sha256sum"} {
+			if _, err := os.Stat(image + ext); err == nil {
+				m.Add(bundle.Checksum, image+ext, bundle.File{Codename: codename})
+			}
+		}
+		for _, ext := range []string{".sig", ".asc", ".minisig"} {
+			if _, err := os.Stat(image + ext); err == nil {
+				m.Add(bundle.Signature, image+ext, bundle.File{Codename: codename})
+			}
+		}
+		bundled++
+	}
+	if bundled == 0 {
+		errorln(errors.New(tr("No factory images found in %s", strings.Join(o.imagesDirs, ", "))), true)
+	}
+
+	oses := platformtools.OSes(platformtools.Version)
+	binaries := o.binaries
+	if binaries == "" {
+		binaries = cwd
+	}
+	for _, goos := range oses {
+		file, name := flasherBinary(binaries, goos)
+		if file == "" {
+			warnln(tr("No flasher for %s in %s, the bundle will not run there", goos, binaries))
+			continue
+		}
+		m.Add(bundle.Flasher, file, bundle.File{Path: name, OS: goos})
+	}
+
+	// Downloaded unless already there, and verified against their checksums either way
+	for _, goos := range oses {
+		platformTools := o.platformTools(os.Stdout)
+		platformTools.OS = goos
+		if err := platformTools.Download(context.Background()); err != nil {
+			errorln(err, true)
+		}
+		file, _ := platformTools.Zip()
+		m.Add(bundle.PlatformTools, file, bundle.File{OS: goos})
+	}
+
+	if err := bundle.Write(args[0], m, printProgress(os.Stdout)); err != nil {
+		errorln(err, true)
+	}
+	var size uint64
+	if info, err := os.Stat(args[0]); err == nil {
+		size = uint64(info.Size())
+	}
+	fmt.Println(Blue(tr("Bundle written to %s (%s)", args[0], humanize.Bytes(size))))
+}
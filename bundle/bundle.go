@@ -0,0 +1,282 @@
+// Copyright 2020 CIS Maxwell, LLC. All rights reserved.
+// Copyright 2020 The Calyx Institute
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package bundle builds and reads offline bundles: a single zip holding the
+// flasher for each OS, the platform tools zips and the factory images, with a
+// manifest of them, to flash where there is no internet access.
+package bundle
+
+import (
+	"archive/zip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gitlab.com/calyxos/device-flasher/internal/archive"
+	"gitlab.com/calyxos/device-flasher/internal/disk"
+	"gitlab.com/calyxos/device-flasher/progress"
+)
+
+// ManifestName is the manifest at the top of a bundle, by which the flasher
+// recognizes one.
+const ManifestName = "bundle.json"
+
+// Kind is what a file of a bundle is for.
+type Kind string
+
+const (
+	Flasher       Kind = "flasher"
+	PlatformTools Kind = "platform-tools"
+	FactoryImage  Kind = "factory-image"
+	Checksum      Kind = "checksum"
+	Signature     Kind = "signature"
+)
+
+// Folders of the bundle, by kind of file. Flashers are at the top.
+var folders = map[Kind]string{
+	PlatformTools: "platform-tools",
+	FactoryImage:  "images",
+	Checksum:      "images",
+	Signature:     "images",
+}
+
+// File is a file of a bundle.
+type File struct {
+	// Path is the slash separated path of the file in the bundle.
+	Path string `json:"path"`
+	Kind Kind   `json:"kind"`
+	// OS is the OS a flasher or platform tools run on.
+	OS string `json:"os,omitempty"`
+	// Codename is the device a factory image is for.
+	Codename string `json:"codename,omitempty"`
+	Size     int64  `json:"size"`
+	SHA256   string `json:"sha256"`
+	// Source is the file added to the bundle by Write.
+	Source string `json:"-"`
+}
+
+// Manifest describes a bundle.
+type Manifest struct {
+	FlasherVersion       string    `json:"flasher_version"`
+	PlatformToolsVersion string    `json:"platform_tools_version"`
+	Created              time.Time `json:"created"`
+	Files                []File    `json:"files"`
+}
+
+// Add adds the file source to the manifest, under the folder of its kind, by
+// its own name or by f.Path if set.
+func (m *Manifest) Add(kind Kind, source string, f File) {
+	f.Kind = kind
+	f.Source = source
+	if f.Path == "" {
+		f.Path = filepath.Base(source)
+	}
+	f.Path = path.Join(folders[kind], f.Path)
+	m.Files = append(m.Files, f)
+}
+
+// Write builds the bundle at file from the sources of the files of m,
+// recording their sizes and sums in m and adding it as the manifest. The
+// bundle is written to a temporary file first, so that an incomplete bundle
+// is never left at file.
+func Write(file string, m *Manifest, report progress.Func) (err error) {
+	var total uint64
+	for _, f := range m.Files {
+		info, err := os.Stat(f.Source)
+		if err != nil {
+			return err
+		}
+		total += uint64(info.Size())
+	}
+	if err := disk.Check(filepath.Dir(file), total); err != nil {
+		return fmt.Errorf("cannot write %s: %w", filepath.Base(file), err)
+	}
+	out, err := ioutil.TempFile(filepath.Dir(file), ".bundle-")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			out.Close()
+			os.Remove(out.Name())
+		}
+	}()
+	w := zip.NewWriter(out)
+	for i := range m.Files {
+		if err := add(w, &m.Files[i], report); err != nil {
+			return fmt.Errorf("%s: %w", m.Files[i].Source, err)
+		}
+	}
+	manifest, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	header := &zip.FileHeader{Name: ManifestName, Method: zip.Deflate, Modified: m.Created}
+	header.SetMode(0644)
+	mw, err := w.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+	if _, err := mw.Write(append(manifest, '\n')); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	return os.Rename(out.Name(), file)
+}
+
+// add copies the source of f into w, filling in its size and sum.
+func add(w *zip.Writer, f *File, report progress.Func) error {
+	in, err := os.Open(f.Source)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	header, err := zip.FileInfoHeader(info)
+	if err != nil {
+		return err
+	}
+	header.Name = f.Path
+	// Zips do not get any smaller
+	header.Method = zip.Deflate
+	if strings.HasSuffix(f.Path, ".zip") {
+		header.Method = zip.Store
+	}
+	header.SetMode(0644)
+	if f.Kind == Flasher {
+		header.SetMode(0755)
+	}
+	out, err := w.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+	report.Report(progress.Event{Op: progress.Archive, File: f.Source, Total: uint64(info.Size())})
+	h := sha256.New()
+	counter := &counter{file: f.Source, total: uint64(info.Size()), report: report}
+	n, err := io.Copy(io.MultiWriter(out, h, counter), in)
+	report.Report(progress.Event{Op: progress.Archive, File: f.Source, Current: uint64(n), Total: uint64(info.Size()), Done: true})
+	if err != nil {
+		return err
+	}
+	f.Size = n
+	f.SHA256 = hex.EncodeToString(h.Sum(nil))
+	return nil
+}
+
+// counter reports the bytes added from file, every MiB.
+type counter struct {
+	file     string
+	written  uint64
+	reported uint64
+	total    uint64
+	report   progress.Func
+}
+
+func (c *counter) Write(p []byte) (int, error) {
+	c.written += uint64(len(p))
+	if c.written-c.reported >= 1<<20 {
+		c.reported = c.written
+		c.report.Report(progress.Event{Op: progress.Archive, File: c.file, Current: c.written, Total: c.total})
+	}
+	return len(p), nil
+}
+
+// Open reads the manifest of the bundle extracted into dir. The error
+// satisfies os.IsNotExist when dir holds no bundle.
+func Open(dir string) (*Manifest, error) {
+	data, err := ioutil.ReadFile(filepath.Join(dir, ManifestName))
+	if err != nil {
+		return nil, err
+	}
+	m := &Manifest{}
+	if err := json.Unmarshal(data, m); err != nil {
+		return nil, fmt.Errorf("%s: %w", ManifestName, err)
+	}
+	for _, f := range m.Files {
+		if !validPath(f.Path) {
+			return nil, fmt.Errorf("%s: %s is outside of the bundle", ManifestName, f.Path)
+		}
+	}
+	return m, nil
+}
+
+// Folder returns the folder of the files of kind in the bundle extracted into dir.
+func Folder(dir string, kind Kind) string {
+	return filepath.Join(dir, filepath.FromSlash(folders[kind]))
+}
+
+// Verify checks that every file of the bundle extracted into dir is there,
+// with the size and sum in the manifest.
+func (m *Manifest) Verify(dir string, report progress.Func) error {
+	for _, f := range m.Files {
+		file := filepath.Join(dir, filepath.FromSlash(f.Path))
+		info, err := os.Stat(file)
+		if err != nil {
+			return err
+		}
+		if info.Size() != f.Size {
+			return fmt.Errorf("%s holds %d bytes instead of %d", f.Path, info.Size(), f.Size)
+		}
+		report.Report(progress.Event{Op: progress.Verify, File: file})
+		err = archive.Verify(file, f.SHA256)
+		report.Report(progress.Event{Op: progress.Verify, File: file, Done: true})
+		if err != nil {
+			return fmt.Errorf("%s: %w", f.Path, err)
+		}
+	}
+	return nil
+}
+
+// SHA256 returns the sum the manifest records for the file at path in the
+// bundle extracted into dir, or "" if it is not part of the bundle.
+func (m *Manifest) SHA256(dir, file string) string {
+	for _, f := range m.Files {
+		if sameFile(filepath.Join(dir, filepath.FromSlash(f.Path)), file) {
+			return f.SHA256
+		}
+	}
+	return ""
+}
+
+func sameFile(a, b string) bool {
+	ai, err := os.Stat(a)
+	if err != nil {
+		return false
+	}
+	bi, err := os.Stat(b)
+	return err == nil && os.SameFile(ai, bi)
+}
+
+// validPath reports whether p is a relative slash path staying inside the bundle.
+func validPath(p string) bool {
+	clean := path.Clean(p)
+	return p != "" && !path.IsAbs(p) && !strings.Contains(p, `\`) && clean != ".." && !strings.HasPrefix(clean, "../")
+}
@@ -0,0 +1,127 @@
+// Copyright 2020 CIS Maxwell, LLC. All rights reserved.
+// Copyright 2020 The Calyx Institute
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bundle
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"gitlab.com/calyxos/device-flasher/internal/archive"
+)
+
+// writeBundle writes a bundle of a flasher, platform tools and a factory
+// image, extracts it and returns the folder it was extracted to.
+func writeBundle(t *testing.T) (string, *Manifest) {
+	t.Helper()
+	src := t.TempDir()
+	for name, data := range map[string]string{
+		"device-flasher.test":                "flasher",
+		"platform-tools-latest-linux.zip":    "platform tools",
+		"redfin-factory-23110200.zip":        "factory image",
+		"redfin-factory-23110200.zip.sha256": "sum  redfin-factory-23110200.zip\n",
+	} {
+		if err := ioutil.WriteFile(filepath.Join(src, name), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	m := &Manifest{FlasherVersion: "test", Created: time.Now().UTC()}
+	m.Add(Flasher, filepath.Join(src, "device-flasher.test"), File{Path: "CalyxOS-flasher_linux", OS: "linux"})
+	m.Add(PlatformTools, filepath.Join(src, "platform-tools-latest-linux.zip"), File{OS: "linux"})
+	m.Add(FactoryImage, filepath.Join(src, "redfin-factory-23110200.zip"), File{Codename: "redfin"})
+	m.Add(Checksum, filepath.Join(src, "redfin-factory-23110200.zip.sha256"), File{Codename: "redfin"})
+	file := filepath.Join(t.TempDir(), "bundle.zip")
+	if err := Write(file, m, nil); err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	if _, err := archive.Extract(file, dir, nil); err != nil {
+		t.Fatal(err)
+	}
+	return dir, m
+}
+
+func TestBundle(t *testing.T) {
+	dir, written := writeBundle(t)
+	m, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Files) != len(written.Files) {
+		t.Fatalf("Open() read %d files, want %d", len(m.Files), len(written.Files))
+	}
+	for _, path := range []string{
+		"CalyxOS-flasher_linux",
+		"platform-tools/platform-tools-latest-linux.zip",
+		"images/redfin-factory-23110200.zip",
+		"images/redfin-factory-23110200.zip.sha256",
+	} {
+		if _, err := os.Stat(filepath.Join(dir, filepath.FromSlash(path))); err != nil {
+			t.Error(err)
+		}
+	}
+	if err := m.Verify(dir, nil); err != nil {
+		t.Errorf("Verify() = %v for a clean bundle", err)
+	}
+	image := filepath.Join(Folder(dir, FactoryImage), "redfin-factory-23110200.zip")
+	if sum, _ := archive.SHA256(image); m.SHA256(dir, image) != sum {
+		t.Errorf("SHA256() = %q, want %q", m.SHA256(dir, image), sum)
+	}
+
+	// Images added after the bundle was written are not part of it
+	unlisted := filepath.Join(Folder(dir, FactoryImage), "redfin-factory-23112100.zip")
+	if err := ioutil.WriteFile(unlisted, []byte("other image"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if sum := m.SHA256(dir, unlisted); sum != "" {
+		t.Errorf("SHA256() = %q for an image not in the manifest, want none", sum)
+	}
+
+	// A changed image fails, even when its size is the same
+	if err := ioutil.WriteFile(image, []byte("FACTORY IMAGE"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Verify(dir, nil); err == nil || !strings.Contains(err.Error(), "redfin-factory-23110200.zip") {
+		t.Errorf("Verify() = %v for a modified image, want it to fail on the image", err)
+	}
+	if err := os.Remove(image); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Verify(dir, nil); err == nil {
+		t.Error("Verify() succeeded without the image")
+	}
+}
+
+func TestOpen(t *testing.T) {
+	if _, err := Open(t.TempDir()); !os.IsNotExist(err) {
+		t.Errorf("Open() = %v without a manifest, want a not exist error", err)
+	}
+	dir := t.TempDir()
+	manifest, err := json.Marshal(&Manifest{Files: []File{{Path: "../outside.zip", Kind: FactoryImage}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, ManifestName), manifest, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Open(dir); err == nil || os.IsNotExist(err) {
+		t.Errorf("Open() = %v for a manifest pointing outside of the bundle, want it refused", err)
+	}
+}
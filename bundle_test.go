@@ -0,0 +1,80 @@
+// Copyright 2020 CIS Maxwell, LLC. All rights reserved.
+// Copyright 2020 The Calyx Institute
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"gitlab.com/calyxos/device-flasher/bundle"
+	"gitlab.com/calyxos/device-flasher/i18n"
+	"gitlab.com/calyxos/device-flasher/internal/archive"
+)
+
+func TestCheckBundle(t *testing.T) {
+	defer func(dir, work string, m *bundle.Manifest, p *i18n.Printer) {
+		cwd, workdir, offline, printer = dir, work, m, p
+	}(cwd, workdir, offline, printer)
+	printer = i18n.NewPrinter("en")
+	workdir = t.TempDir()
+
+	// A bundle of one factory image, extracted where the flasher runs from
+	src := filepath.Join(t.TempDir(), "redfin-factory-23110200.zip")
+	if err := ioutil.WriteFile(src, []byte("factory image"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	m := &bundle.Manifest{Created: time.Now().UTC()}
+	m.Add(bundle.FactoryImage, src, bundle.File{Codename: "redfin"})
+	file := filepath.Join(t.TempDir(), "bundle.zip")
+	if err := bundle.Write(file, m, nil); err != nil {
+		t.Fatal(err)
+	}
+	cwd = t.TempDir()
+	if _, err := archive.Extract(file, cwd, nil); err != nil {
+		t.Fatal(err)
+	}
+	openBundle()
+	if offline == nil {
+		t.Fatal("the bundle was not recognized")
+	}
+	images := defaultImagesDir()
+	image := filepath.Join(images, "redfin-factory-23110200.zip")
+	unlisted := filepath.Join(images, "redfin-factory-23112100.zip")
+	if err := ioutil.WriteFile(unlisted, []byte("other image"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := checkBundle(&options{}, map[string]string{"redfin": image}); err != nil {
+		t.Errorf("checkBundle() = %v for the image of the bundle", err)
+	}
+	if err := checkBundle(&options{}, map[string]string{"redfin": unlisted}); err == nil || !strings.Contains(err.Error(), "not in the manifest") {
+		t.Errorf("checkBundle() = %v for an image not in the manifest, want it refused", err)
+	}
+	if err := ioutil.WriteFile(image, []byte("FACTORY IMAGE"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(image, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkBundle(&options{}, map[string]string{"redfin": image}); err == nil || !strings.Contains(err.Error(), "does not match") {
+		t.Errorf("checkBundle() = %v for a modified image, want it refused", err)
+	}
+}
@@ -0,0 +1,159 @@
+// Copyright 2020 CIS Maxwell, LLC. All rights reserved.
+// Copyright 2020 The Calyx Institute
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"gitlab.com/calyxos/device-flasher/cache"
+	"gitlab.com/calyxos/device-flasher/internal/humanize"
+)
+
+// cache returns the cache of extracted zips, shared by everything in the run
+// so that the sums it records are not lost.
+func (o *options) cache() *cache.Cache {
+	if o.extractions == nil {
+		o.extractions = cache.New(cacheDir())
+	}
+	return o.extractions
+}
+
+// cacheState describes an entry as listed by cache list.
+type cacheState struct {
+	SHA256   string    `json:"sha256"`
+	Zip      string    `json:"zip"`
+	Size     uint64    `json:"size"`
+	LastUsed time.Time `json:"last_used"`
+	// State is ok, unused (its zip is gone or changed), incomplete or, with -verify, changed.
+	State string `json:"state"`
+}
+
+func cacheCommand(o *options, args []string) {
+	if len(args) != 1 || (args[0] != "list" && args[0] != "prune") {
+		errorln(fmt.Errorf("expected %s cache list or %s cache prune", program, program), true)
+	}
+	c := o.cache()
+	entries, err := c.Entries()
+	if err != nil {
+		errorln(err, true)
+	}
+	if args[0] == "prune" {
+		var stale []*cache.Entry
+		for _, e := range entries {
+			if o.all || !e.Complete() || !c.InUse(e) {
+				stale = append(stale, e)
+			}
+		}
+		removeExtractions(o, stale)
+		return
+	}
+	states := []cacheState{}
+	for _, e := range entries {
+		state := "ok"
+		switch {
+		case !e.Complete():
+			state = "incomplete"
+		case o.verify && e.Verify() != nil:
+			state = "changed"
+		case !c.InUse(e):
+			state = "unused"
+		}
+		states = append(states, cacheState{SHA256: e.SHA256, Zip: e.Zip, Size: e.Size, LastUsed: e.LastUsed, State: state})
+	}
+	switch {
+	case o.json:
+		printJSON(states)
+	case len(states) == 0:
+		fmt.Println(tr("No extractions in %s", c.Dir))
+	default:
+		fmt.Println()
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, tr("SHA-256\tZIP\tSIZE\tLAST USED\tSTATE"))
+		for _, s := range states {
+			lastUsed := "-"
+			if !s.LastUsed.IsZero() {
+				lastUsed = s.LastUsed.Local().Format("2006-01-02 15:04")
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", s.SHA256[:12], orNone(s.Zip), humanize.Bytes(s.Size), lastUsed, s.State)
+		}
+		w.Flush()
+	}
+}
+
+func cleanCommand(o *options, args []string) {
+	entries, err := o.cache().Entries()
+	if err != nil {
+		errorln(err, true)
+	}
+	if len(entries) <= o.keepLast {
+		entries = nil
+	} else {
+		entries = entries[o.keepLast:]
+	}
+	removeExtractions(o, entries)
+}
+
+// cleanUp applies the cleanup setting at the end of flashing, once the
+// outcome of every device is known.
+func cleanUp(o *options, succeeded bool) {
+	c := o.cache()
+	var entries []*cache.Entry
+	var err error
+	switch o.settings.Cleanup {
+	case "after-success":
+		if succeeded {
+			entries, err = c.Used()
+		}
+	case "keep-last":
+		entries, err = c.Entries()
+		if len(entries) <= o.settings.KeepLast {
+			entries = nil
+		} else {
+			entries = entries[o.settings.KeepLast:]
+		}
+	}
+	if err != nil {
+		errorln(err, false)
+		return
+	}
+	if len(entries) == 0 {
+		return
+	}
+	removeExtractions(o, entries)
+}
+
+// removeExtractions removes entries from the cache and prints the space freed.
+func removeExtractions(o *options, entries []*cache.Entry) {
+	var freed uint64
+	for _, e := range entries {
+		// adb keeps running from extracted platform tools, and Windows does
+		// not delete files in use
+		platformTools := o.platformTools(ioutil.Discard)
+		platformTools.Dir = e.Dir
+		platformTools.Kill(context.Background())
+		size, err := o.cache().Remove(e)
+		freed += size
+		if err != nil {
+			errorln(err, false)
+		}
+	}
+	fmt.Println(tr("Removed %d extraction(s), freeing %s", len(entries), humanize.Bytes(freed)))
+}
@@ -0,0 +1,436 @@
+// Copyright 2020 CIS Maxwell, LLC. All rights reserved.
+// Copyright 2020 The Calyx Institute
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package cache keeps zips extracted by the SHA-256 sum of the zip, so that
+// unchanged zips are only extracted once.
+package cache
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"gitlab.com/calyxos/device-flasher/internal/archive"
+	"gitlab.com/calyxos/device-flasher/progress"
+)
+
+// Cache keeps extractions in Dir:
+//
+//	sums.json                  the sums of the zips seen, by path, size and modification time
+//	<sha256>/manifest.json     what was extracted, written once the extraction is complete
+//	<sha256>/<top folder>/...  the extracted files
+type Cache struct {
+	Dir string
+
+	mu   sync.Mutex
+	sums map[string]sum
+	// used holds the sums of the zips extracted or reused through this Cache.
+	used map[string]bool
+}
+
+// sum is the SHA-256 of a zip as it was when hashed.
+type sum struct {
+	Size     int64     `json:"size"`
+	Modified time.Time `json:"modified"`
+	SHA256   string    `json:"sha256"`
+}
+
+// Entry is an extraction kept in the cache.
+type Entry struct {
+	// SHA256 is the sum of the zip, which names the folder of the entry.
+	SHA256 string `json:"sha256"`
+	// Zip is the name of the zip extracted.
+	Zip      string    `json:"zip"`
+	Created  time.Time `json:"created"`
+	LastUsed time.Time `json:"last_used"`
+	Size     uint64    `json:"size"`
+	Files    []File    `json:"files"`
+	// Dirs are the folders extracted, which Remove deletes once empty.
+	Dirs []string `json:"dirs,omitempty"`
+	// Dir is the folder of the entry, holding the top folders of the zip.
+	Dir string `json:"-"`
+}
+
+// File is a file extracted, with its size, modification time and SHA-256 sum.
+type File struct {
+	Path     string    `json:"path"`
+	Size     int64     `json:"size"`
+	Modified time.Time `json:"modified"`
+	SHA256   string    `json:"sha256"`
+}
+
+func New(dir string) *Cache {
+	return &Cache{Dir: dir}
+}
+
+// SHA256 returns the hex encoded SHA-256 sum of file, only hashing it again
+// when its size or modification time changed since it was last hashed.
+func (c *Cache) SHA256(file string) (string, error) {
+	file, err := filepath.Abs(file)
+	if err != nil {
+		return "", err
+	}
+	info, err := os.Stat(file)
+	if err != nil {
+		return "", err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.loadSums()
+	if s, ok := c.sums[file]; ok && s.Size == info.Size() && s.Modified.Equal(info.ModTime()) {
+		return s.SHA256, nil
+	}
+	hash, err := archive.SHA256(file)
+	if err != nil {
+		return "", err
+	}
+	c.sums[file] = sum{Size: info.Size(), Modified: info.ModTime(), SHA256: hash}
+	return hash, c.saveSums()
+}
+
+func (c *Cache) loadSums() {
+	if c.sums != nil {
+		return
+	}
+	c.sums = map[string]sum{}
+	if data, err := ioutil.ReadFile(filepath.Join(c.Dir, "sums.json")); err == nil {
+		_ = json.Unmarshal(data, &c.sums)
+	}
+}
+
+func (c *Cache) saveSums() error {
+	return writeJSON(filepath.Join(c.Dir, "sums.json"), c.sums)
+}
+
+// Extract returns the folder holding the extracted contents of the zip file,
+// extracting it unless an intact extraction of the same zip is in the cache:
+// one whose files all hash to the sums in its manifest.
+func (c *Cache) Extract(file string, report progress.Func) (string, error) {
+	hash, err := c.SHA256(file)
+	if err != nil {
+		return "", err
+	}
+	c.mu.Lock()
+	if c.used == nil {
+		c.used = map[string]bool{}
+	}
+	c.used[hash] = true
+	c.mu.Unlock()
+	entry, err := c.entry(hash)
+	if err == nil && entry.Verify() == nil {
+		entry.LastUsed = time.Now()
+		return entry.Dir, writeJSON(filepath.Join(entry.Dir, "manifest.json"), entry)
+	}
+	// What is left of a damaged extraction goes first, and archive.Extract
+	// replaces what an interrupted one left
+	if err == nil {
+		if _, err := c.Remove(entry); err != nil {
+			return "", err
+		}
+	}
+	dir := filepath.Join(c.Dir, hash)
+	extracted, err := archive.Extract(file, dir, report)
+	if err != nil {
+		return "", err
+	}
+	entry = &Entry{SHA256: hash, Zip: filepath.Base(file), Created: time.Now(), Dir: dir}
+	entry.LastUsed = entry.Created
+	for _, path := range extracted {
+		info, err := os.Lstat(path)
+		if err != nil {
+			return "", err
+		}
+		rel, _ := filepath.Rel(dir, path)
+		if info.IsDir() {
+			entry.Dirs = append(entry.Dirs, filepath.ToSlash(rel))
+			continue
+		}
+		sum, err := archive.SHA256(path)
+		if err != nil {
+			return "", err
+		}
+		entry.Files = append(entry.Files, File{Path: filepath.ToSlash(rel), Size: info.Size(), Modified: info.ModTime(), SHA256: sum})
+		entry.Size += uint64(info.Size())
+	}
+	return dir, writeJSON(filepath.Join(dir, "manifest.json"), entry)
+}
+
+// Extracted reports whether an extraction of the zip file whose files are
+// unchanged since is in the cache, so that Extract would not write anything
+// unless they fail to hash to their sums.
+func (c *Cache) Extracted(file string) bool {
+	hash, err := c.SHA256(file)
+	if err != nil {
+		return false
+	}
+	entry, err := c.entry(hash)
+	return err == nil && entry.check() == nil
+}
+
+func (c *Cache) entry(hash string) (*Entry, error) {
+	dir := filepath.Join(c.Dir, hash)
+	data, err := ioutil.ReadFile(filepath.Join(dir, "manifest.json"))
+	if err != nil {
+		return nil, err
+	}
+	entry := &Entry{}
+	if err := json.Unmarshal(data, entry); err != nil {
+		return nil, fmt.Errorf("%s: %w", hash, err)
+	}
+	entry.Dir = dir
+	return entry, nil
+}
+
+// check makes sure every file of the entry is there with its size and
+// modification time, which catches extractions that did not complete and
+// files written to since. Manifests written before modification times were
+// recorded only have sizes to go by.
+func (e *Entry) check() error {
+	for _, f := range e.Files {
+		info, err := os.Lstat(filepath.Join(e.Dir, filepath.FromSlash(f.Path)))
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() || info.Size() != f.Size || (!f.Modified.IsZero() && !info.ModTime().Equal(f.Modified)) {
+			return fmt.Errorf("%s changed", f.Path)
+		}
+	}
+	return nil
+}
+
+// Verify hashes every file of the entry again and compares them to the manifest.
+func (e *Entry) Verify() error {
+	if err := e.check(); err != nil {
+		return err
+	}
+	for _, f := range e.Files {
+		hash, err := archive.SHA256(filepath.Join(e.Dir, filepath.FromSlash(f.Path)))
+		if err != nil {
+			return err
+		}
+		if hash != f.SHA256 {
+			return fmt.Errorf("%s changed", f.Path)
+		}
+	}
+	return nil
+}
+
+// Entries lists the extractions in the cache, most recently used first. Folders
+// without a readable manifest, left by extractions that did not complete, are
+// listed with only their SHA256 and Dir.
+func (c *Cache) Entries() ([]*Entry, error) {
+	files, err := ioutil.ReadDir(c.Dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var entries []*Entry
+	for _, file := range files {
+		if !file.IsDir() || !isSum(file.Name()) {
+			continue
+		}
+		entry, err := c.entry(file.Name())
+		if err != nil {
+			entry = &Entry{SHA256: file.Name(), Dir: filepath.Join(c.Dir, file.Name())}
+		}
+		entries = append(entries, entry)
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].LastUsed.After(entries[j].LastUsed)
+	})
+	return entries, nil
+}
+
+// Complete reports whether the extraction of the entry completed and its files are still there.
+func (e *Entry) Complete() bool {
+	return !e.Created.IsZero() && e.check() == nil
+}
+
+// InUse reports whether a zip with the sum of the entry is still where it was
+// hashed, unchanged.
+func (c *Cache) InUse(e *Entry) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.loadSums()
+	for file, s := range c.sums {
+		if s.SHA256 != e.SHA256 {
+			continue
+		}
+		if info, err := os.Stat(file); err == nil && info.Size() == s.Size && info.ModTime().Equal(s.Modified) {
+			return true
+		}
+	}
+	return false
+}
+
+// Used returns the entries extracted or reused through c, most recently used first.
+func (c *Cache) Used() ([]*Entry, error) {
+	entries, err := c.Entries()
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var used []*Entry
+	for _, e := range entries {
+		if c.used[e.SHA256] {
+			used = append(used, e)
+		}
+	}
+	return used, nil
+}
+
+// Remove deletes the files and folders listed in the manifest of an entry,
+// then the manifest and the entry folder once empty, and returns the bytes it
+// freed. Nothing else is deleted but the temporary folders of extractions
+// that were interrupted, named by archive.Extract. Sums of zips that are gone
+// are forgotten along the way.
+func (c *Cache) Remove(e *Entry) (uint64, error) {
+	if filepath.Dir(e.Dir) != filepath.Clean(c.Dir) || !isSum(filepath.Base(e.Dir)) {
+		return 0, errors.New(e.Dir + " is not in the cache")
+	}
+	var freed uint64
+	remove := func(path string) error {
+		info, err := os.Lstat(path)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+		if info.Mode().IsRegular() {
+			freed += uint64(info.Size())
+		}
+		return nil
+	}
+	var dirs []string
+	for _, f := range e.Files {
+		path, err := e.path(f.Path)
+		if err != nil {
+			return freed, err
+		}
+		if err := remove(path); err != nil {
+			return freed, err
+		}
+		for dir := filepath.Dir(path); dir != e.Dir; dir = filepath.Dir(dir) {
+			dirs = append(dirs, dir)
+		}
+	}
+	for _, d := range e.Dirs {
+		path, err := e.path(d)
+		if err != nil {
+			return freed, err
+		}
+		dirs = append(dirs, path)
+	}
+	temps, _ := filepath.Glob(filepath.Join(e.Dir, ".extract-*"))
+	replaced, _ := filepath.Glob(filepath.Join(e.Dir, ".replaced-*"))
+	for _, tmp := range append(temps, replaced...) {
+		tmpSize, err := size(tmp)
+		if err != nil {
+			return freed, err
+		}
+		if err := os.RemoveAll(tmp); err != nil {
+			return freed, err
+		}
+		freed += tmpSize
+	}
+	if err := remove(filepath.Join(e.Dir, "manifest.json")); err != nil {
+		return freed, err
+	}
+	// Deepest first, so that folders are empty by the time their parent is
+	// removed. Folders holding anything else stay.
+	sort.Slice(dirs, func(i, j int) bool { return len(dirs[i]) > len(dirs[j]) })
+	for _, dir := range append(dirs, e.Dir) {
+		_ = os.Remove(dir)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.loadSums()
+	for file := range c.sums {
+		if _, err := os.Stat(file); os.IsNotExist(err) {
+			delete(c.sums, file)
+		}
+	}
+	return freed, c.saveSums()
+}
+
+// path returns the path of a file or folder of the entry from its path in the manifest.
+func (e *Entry) path(rel string) (string, error) {
+	path := filepath.Join(e.Dir, filepath.FromSlash(rel))
+	if !strings.HasPrefix(path, e.Dir+string(os.PathSeparator)) {
+		return "", fmt.Errorf("%s is outside of %s", rel, e.Dir)
+	}
+	return path, nil
+}
+
+// isSum reports whether name is a hex encoded SHA-256 sum.
+func isSum(name string) bool {
+	_, err := hex.DecodeString(name)
+	return err == nil && len(name) == 64
+}
+
+// size returns the bytes taken by the files in dir.
+func size(dir string) (uint64, error) {
+	var total uint64
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.Mode().IsRegular() {
+			total += uint64(info.Size())
+		}
+		return nil
+	})
+	return total, err
+}
+
+// writeJSON replaces path with v as JSON, through a temporary file so that
+// it is never left half written.
+func writeJSON(path string, v interface{}) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(filepath.Dir(path), ".tmp-")
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(f)
+	encoder.SetIndent("", "  ")
+	err = encoder.Encode(v)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), path)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
@@ -0,0 +1,279 @@
+// Copyright 2020 CIS Maxwell, LLC. All rights reserved.
+// Copyright 2020 The Calyx Institute
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"archive/zip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeZip writes a zip holding files, by name, in dir and returns its path.
+func writeZip(t *testing.T, dir string, files map[string]string) string {
+	t.Helper()
+	file := filepath.Join(dir, "redfin-factory-23110200.zip")
+	f, err := os.Create(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := zip.NewWriter(f)
+	for name, data := range files {
+		entry, err := w.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := entry.Write([]byte(data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func readFile(t *testing.T, file string) string {
+	t.Helper()
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+var files = map[string]string{
+	"redfin-tq3a/android-info.txt": "require board=redfin\n",
+	"redfin-tq3a/flash-all.sh":     "#!/bin/sh\n",
+	"redfin-tq3a/image-redfin.zip": "image",
+}
+
+func TestExtractReuses(t *testing.T) {
+	dir := t.TempDir()
+	src := writeZip(t, dir, files)
+	c := New(filepath.Join(dir, "cache"))
+	extracted, err := c.Extract(src, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash, err := c.SHA256(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.Join(c.Dir, hash); extracted != want {
+		t.Errorf("Extract() = %s, want %s", extracted, want)
+	}
+	for _, name := range []string{"manifest.json", "../sums.json"} {
+		if _, err := os.Stat(filepath.Join(extracted, name)); err != nil {
+			t.Error(err)
+		}
+	}
+	entries, err := c.Entries()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].SHA256 != hash || len(entries[0].Files) != len(files) || !entries[0].Complete() {
+		t.Fatalf("Entries() = %+v, want one complete entry of %d files", entries, len(files))
+	}
+	created := entries[0].Created
+
+	// A new Cache reads the sums and the manifest back
+	c = New(c.Dir)
+	if !c.Extracted(src) {
+		t.Error("Extracted() = false after Extract")
+	}
+	if again, err := c.Extract(src, nil); err != nil || again != extracted {
+		t.Fatalf("Extract() = %s, %v, want %s", again, err, extracted)
+	}
+	entries, err = c.Entries()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !entries[0].Created.Equal(created) {
+		t.Errorf("extracted again at %s, want the extraction of %s reused", entries[0].Created, created)
+	}
+	if err := entries[0].Verify(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestExtractReplacesModified(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(t *testing.T, file string)
+	}{
+		{
+			name: "different size",
+			modify: func(t *testing.T, file string) {
+				if err := ioutil.WriteFile(file, []byte("tampered image"), 0644); err != nil {
+					t.Fatal(err)
+				}
+			},
+		},
+		{
+			name: "same size and modification time",
+			modify: func(t *testing.T, file string) {
+				info, err := os.Stat(file)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err := ioutil.WriteFile(file, []byte("IMAGE"), 0644); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.Chtimes(file, info.ModTime(), info.ModTime()); err != nil {
+					t.Fatal(err)
+				}
+			},
+		},
+		{
+			name: "removed",
+			modify: func(t *testing.T, file string) {
+				if err := os.Remove(file); err != nil {
+					t.Fatal(err)
+				}
+			},
+		},
+		{
+			name: "half-written",
+			modify: func(t *testing.T, file string) {
+				if err := os.Remove(filepath.Join(filepath.Dir(filepath.Dir(file)), "manifest.json")); err != nil {
+					t.Fatal(err)
+				}
+				if err := ioutil.WriteFile(file, []byte("ima"), 0644); err != nil {
+					t.Fatal(err)
+				}
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			src := writeZip(t, dir, files)
+			c := New(filepath.Join(dir, "cache"))
+			extracted, err := c.Extract(src, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			image := filepath.Join(extracted, "redfin-tq3a", "image-redfin.zip")
+			test.modify(t, image)
+			if _, err := c.Extract(src, nil); err != nil {
+				t.Fatal(err)
+			}
+			if got := readFile(t, image); got != "image" {
+				t.Errorf("image-redfin.zip holds %q after Extract, want it extracted again", got)
+			}
+			entries, err := c.Entries()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(entries) != 1 || entries[0].Verify() != nil {
+				t.Errorf("Entries() = %+v, want one intact entry", entries)
+			}
+		})
+	}
+}
+
+func TestExtractNewZip(t *testing.T) {
+	dir := t.TempDir()
+	src := writeZip(t, dir, files)
+	c := New(filepath.Join(dir, "cache"))
+	first, err := c.Extract(src, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The same name with other contents is another extraction
+	changed := map[string]string{"redfin-tq3a/image-redfin.zip": "other image"}
+	for name, data := range files {
+		if _, ok := changed[name]; !ok {
+			changed[name] = data
+		}
+	}
+	later := time.Now().Add(time.Minute)
+	writeZip(t, dir, changed)
+	if err := os.Chtimes(src, later, later); err != nil {
+		t.Fatal(err)
+	}
+	second, err := c.Extract(src, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second == first {
+		t.Fatalf("Extract() reused %s for a changed zip", first)
+	}
+	if got := readFile(t, filepath.Join(second, "redfin-tq3a", "image-redfin.zip")); got != "other image" {
+		t.Errorf("image-redfin.zip holds %q, want %q", got, "other image")
+	}
+}
+
+func TestRemoveKeepsUnlisted(t *testing.T) {
+	dir := t.TempDir()
+	src := writeZip(t, dir, files)
+	c := New(filepath.Join(dir, "cache"))
+	extracted, err := c.Extract(src, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unlisted := []string{
+		filepath.Join(extracted, "notes.txt"),
+		filepath.Join(extracted, "redfin-tq3a", "boot.img"),
+	}
+	for _, file := range unlisted {
+		if err := ioutil.WriteFile(file, []byte("mine"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	entries, err := c.Entries()
+	if err != nil {
+		t.Fatal(err)
+	}
+	freed, err := c.Remove(entries[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var want uint64
+	for _, data := range files {
+		want += uint64(len(data))
+	}
+	if freed < want {
+		t.Errorf("Remove() freed %d bytes, want at least %d", freed, want)
+	}
+	for _, file := range unlisted {
+		if got := readFile(t, file); got != "mine" {
+			t.Errorf("%s holds %q, want it left alone", file, got)
+		}
+	}
+	for name := range files {
+		if _, err := os.Stat(filepath.Join(extracted, filepath.FromSlash(name))); !os.IsNotExist(err) {
+			t.Errorf("%s is still there: %v", name, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(extracted, "manifest.json")); !os.IsNotExist(err) {
+		t.Errorf("manifest.json is still there: %v", err)
+	}
+	if _, err := os.Stat(src); err != nil {
+		t.Errorf("the zip is gone: %v", err)
+	}
+
+	// Entries outside the cache are refused
+	if _, err := c.Remove(&Entry{Dir: dir}); err == nil {
+		t.Errorf("Remove(%s) succeeded, want it refused", dir)
+	}
+}
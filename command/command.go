@@ -0,0 +1,135 @@
+// Copyright 2020 CIS Maxwell, LLC. All rights reserved.
+// Copyright 2020 The Calyx Institute
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package command runs external programs such as adb, fastboot and flash-all.
+//
+// Everything that starts a process goes through a Runner, so callers can swap in
+// fakes, record invocations, run commands elsewhere or bound them with timeouts.
+package command
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// Cmd is a command to run.
+type Cmd struct {
+	// Argv holds the program followed by its arguments.
+	Argv []string
+	// Dir is the working directory, the current one if empty.
+	Dir string
+	// Env is added to the environment of the current process.
+	Env []string
+	// Stdout and Stderr, if set, receive output while the command runs.
+	// The output is collected in the Result either way.
+	Stdout io.Writer
+	Stderr io.Writer
+}
+
+// Result is what a finished command produced.
+type Result struct {
+	Stdout   []byte
+	Stderr   []byte
+	ExitCode int
+}
+
+// Combined returns stdout followed by stderr. fastboot prints most of its
+// responses to stderr, so its parsers read both.
+func (r Result) Combined() []byte {
+	return append(append([]byte{}, r.Stdout...), r.Stderr...)
+}
+
+// Runner runs commands.
+//
+// Run returns an error if the command cannot be started, is stopped by ctx, or
+// exits with a non-zero status, in which case the error is an *ExitError.
+// The Result holds whatever output was collected.
+type Runner interface {
+	Run(ctx context.Context, cmd Cmd) (Result, error)
+}
+
+// RunnerFunc adapts a function to the Runner interface.
+type RunnerFunc func(ctx context.Context, cmd Cmd) (Result, error)
+
+func (f RunnerFunc) Run(ctx context.Context, cmd Cmd) (Result, error) {
+	return f(ctx, cmd)
+}
+
+// ExitError reports a command that exited with a non-zero status.
+type ExitError struct {
+	Argv     []string
+	ExitCode int
+	Stderr   []byte
+}
+
+func (e *ExitError) Error() string {
+	msg := fmt.Sprintf("%s exited with status %d", strings.Join(e.Argv, " "), e.ExitCode)
+	if stderr := strings.TrimSpace(string(e.Stderr)); stderr != "" {
+		msg += ": " + stderr
+	}
+	return msg
+}
+
+// Exec runs commands as local processes.
+type Exec struct{}
+
+func (Exec) Run(ctx context.Context, cmd Cmd) (Result, error) {
+	if len(cmd.Argv) == 0 {
+		return Result{}, errors.New("empty command")
+	}
+	var stdout, stderr bytes.Buffer
+	c := exec.CommandContext(ctx, cmd.Argv[0], cmd.Argv[1:]...)
+	c.Dir = cmd.Dir
+	if len(cmd.Env) > 0 {
+		c.Env = append(os.Environ(), cmd.Env...)
+	}
+	c.Stdout = &stdout
+	if cmd.Stdout != nil {
+		c.Stdout = io.MultiWriter(&stdout, cmd.Stdout)
+	}
+	c.Stderr = &stderr
+	if cmd.Stderr != nil {
+		c.Stderr = io.MultiWriter(&stderr, cmd.Stderr)
+	}
+	err := c.Run()
+	result := Result{Stdout: stdout.Bytes(), Stderr: stderr.Bytes()}
+	if c.ProcessState != nil {
+		result.ExitCode = c.ProcessState.ExitCode()
+	}
+	if ctx.Err() != nil {
+		return result, ctx.Err()
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return result, &ExitError{Argv: cmd.Argv, ExitCode: result.ExitCode, Stderr: result.Stderr}
+	}
+	return result, err
+}
+
+// Timeout returns a Runner that stops every command r runs after d.
+func Timeout(r Runner, d time.Duration) Runner {
+	return RunnerFunc(func(ctx context.Context, cmd Cmd) (Result, error) {
+		ctx, cancel := context.WithTimeout(ctx, d)
+		defer cancel()
+		return r.Run(ctx, cmd)
+	})
+}
@@ -0,0 +1,355 @@
+// Copyright 2020 CIS Maxwell, LLC. All rights reserved.
+// Copyright 2020 The Calyx Institute
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"gitlab.com/calyxos/device-flasher/cache"
+	"gitlab.com/calyxos/device-flasher/flash"
+	"gitlab.com/calyxos/device-flasher/i18n"
+)
+
+// options holds the flags shared by subcommands; each subcommand registers the ones it uses.
+type options struct {
+	parallel bool
+	serial   string
+	json     bool
+	lang     string
+	web      string
+	listen   string
+	token    string
+	operator string
+	codename string
+	result   string
+	since    string
+	until    string
+	csv      bool
+	tag      string
+	// requireTag only lets devices with an asset tag be started in station mode.
+	requireTag  bool
+	hooks       hookFlag
+	config      string
+	imagesDirs  listFlag
+	recursive   bool
+	concurrency int
+	build       string
+	choose      bool
+	workdir     string
+	cleanup     string
+	keepLast    int
+	binaries    string
+	all         bool
+	verify      bool
+	// extractions is the cache of extracted zips, see cache.
+	extractions *cache.Cache
+	// settings are the effective settings, from the configuration file and the flags.
+	settings config
+}
+
+// hookFlag collects -hook phase=command flags.
+type hookFlag map[flash.Hook][]string
+
+func (h hookFlag) String() string {
+	var hooks []string
+	for _, hook := range flash.Hooks {
+		for _, line := range h[hook] {
+			hooks = append(hooks, string(hook)+"="+line)
+		}
+	}
+	return strings.Join(hooks, ", ")
+}
+
+func (h hookFlag) Set(value string) error {
+	parts := strings.SplitN(value, "=", 2)
+	for _, hook := range flash.Hooks {
+		if len(parts) == 2 && parts[0] == string(hook) && strings.TrimSpace(parts[1]) != "" {
+			h[hook] = append(h[hook], parts[1])
+			return nil
+		}
+	}
+	return fmt.Errorf("expected phase=command, with phase one of %s", hookNames())
+}
+
+// listFlag collects the values of a flag that can be repeated.
+type listFlag []string
+
+func (l *listFlag) String() string {
+	return strings.Join(*l, ", ")
+}
+
+func (l *listFlag) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+func hookNames() string {
+	var names []string
+	for _, hook := range flash.Hooks {
+		names = append(names, string(hook))
+	}
+	return strings.Join(names, ", ")
+}
+
+// apiToken returns the token the dashboard and the API require, from the token flag or the
+// DEVICE_FLASHER_TOKEN environment variable, which keeps it out of process lists.
+func (o *options) apiToken() string {
+	if o.token != "" {
+		return o.token
+	}
+	return os.Getenv("DEVICE_FLASHER_TOKEN")
+}
+
+type subcommand struct {
+	name    string
+	args    string
+	summary string
+	help    string
+	flags   *flag.FlagSet
+	run     func(o *options, args []string)
+}
+
+var program = filepath.Base(os.Args[0])
+
+// defaultCommand runs when no subcommand is given, so double-clicking the flasher keeps working.
+const defaultCommand = "flash"
+
+func subcommands(o *options) []*subcommand {
+	if o.hooks == nil {
+		o.hooks = hookFlag{}
+	}
+	commands := []*subcommand{
+		{
+			name:    "devices",
+			summary: "List detected devices and the images matching them",
+			help:    "Lists the devices attached through adb and fastboot, along with the factory\nand OTA images in the images folder that match them.",
+			run:     devicesCommand,
+		},
+		{
+			name:    "flash",
+			summary: "Unlock, flash and relock devices (default)",
+			help:    "Extracts the factory images in the images folder, then unlocks the bootloader of each\ndevice, runs flash-all and locks the bootloader again.",
+			run:     flashCommand,
+		},
+		{
+			name:    "unlock",
+			summary: "Unlock the bootloader of devices",
+			help:    "Reboots devices into fastboot mode and waits for their bootloader to be unlocked.\nUnlocking erases all data on the device.",
+			run:     unlockCommand,
+		},
+		{
+			name:    "lock",
+			summary: "Lock the bootloader of devices",
+			help:    "Reboots devices into fastboot mode and waits for their bootloader to be locked,\nthen boots them. Only lock devices running the software they were flashed with.",
+			run:     lockCommand,
+		},
+		{
+			name:    "ota",
+			args:    "[ota.zip...]",
+			summary: "Sideload OTA updates through adb",
+			help:    "Reboots devices into recovery, sideloads the matching OTA and checks that they\nboot into the new build. Uses the given zips, or the codename-ota-*.zip files in\nthe images folder.",
+			run:     otaCommand,
+		},
+		{
+			name:    "verify",
+			summary: "Check the images and platform tools",
+			help:    "Checks that the factory and OTA zips in the images folder are intact and match\nthe <zip>.sha256 files next to them, and that the platform tools match their checksum.\nFactory images are also checked for everything flash-all needs: a single folder with\nflash-all, android-info.txt, the bootloader and radio images, and an image-*.zip holding\nandroid-info.txt, boot.img, system.img and vbmeta.img.",
+			run:     verifyCommand,
+		},
+		{
+			name:    "download",
+			args:    "[image-url...]",
+			summary: "Download the platform tools and images",
+			help:    "Downloads and verifies the platform tools, and downloads the given image URLs\ninto the images folder.",
+			run:     downloadCommand,
+		},
+		{
+			name:    "history",
+			summary: "List the devices flashed",
+			help:    "Lists the devices flashed, from the inventory kept in inventory.jsonl in the work folder\n(-workdir), with the image, outcome and bootloader state of each.",
+			run:     historyCommand,
+		},
+		{
+			name:    "serve",
+			summary: "Run a flashing station controlled over HTTP",
+			help:    "Extracts the factory images in the images folder and serves the dashboard and a JSON API\nto flash attached devices, for stations driven by other programs:\n\n  GET  /api/devices           attached devices, with the factory image matching them\n  GET  /api/images            factory images by codename\n  GET  /api/jobs              every job, oldest first\n  POST /api/jobs              start a job: {\"serial\": \"...\", \"asset_tag\": \"...\", \"skip_lock\": false, \"timeout\": 3600}\n  GET  /api/jobs/{id}         a job\n  GET  /api/jobs/{id}/log     its log as text\n  POST /api/jobs/{id}/cancel  stop it\n\nPrometheus metrics are served at /metrics.",
+			run:     serveCommand,
+		},
+		{
+			name:    "info",
+			summary: "Print the bootloader state of devices",
+			help:    "Prints what each device in fastboot mode reports through fastboot getvar all.",
+			run:     infoCommand,
+		},
+		{
+			name:    "config",
+			args:    "show",
+			summary: "Print the effective settings",
+			help:    "Prints the settings in effect, from the configuration file and the defaults, as JSON.\nThe configuration file is device-flasher/config.json in the user configuration folder\nunless given with -config, and takes the same keys. Flags override it.\n\n\"output\": \"json\" only applies to devices, info, history and cache, like -json;\nthe other commands refuse to run with it.",
+			run:     configCommand,
+		},
+		{
+			name:    "bundle",
+			args:    "<bundle.zip>",
+			summary: "Build an offline bundle",
+			help:    "Builds a zip holding the flasher for each OS, the platform tools for each OS verified\nagainst their checksums, the factory image of each device with the checksums and signatures\nnext to it, and a manifest of them with their SHA-256 sums.\n\nExtracted on a computer without internet access, the flasher in it takes its images and\nplatform tools from the bundle, checks them against the manifest and downloads nothing.",
+			run:     bundleCommand,
+		},
+		{
+			name:    "clean",
+			summary: "Remove the extracted zips kept",
+			help:    "Removes the extracted factory images and platform tools kept in extracted/ in the work\nfolder (-workdir), and prints how much space it freed. Only the files listed in the\nmanifest of each extraction are removed.",
+			run:     cleanCommand,
+		},
+		{
+			name:    "cache",
+			args:    "list|prune",
+			summary: "List or remove the extracted zips kept",
+			help:    "Factory images and platform tools are extracted once into extracted/ in the work folder\n(-workdir), in a folder named after the SHA-256 of the zip with a manifest of the files\nextracted, and reused while the zip is unchanged.\n\nlist shows them, prune removes the ones whose zip is gone or changed and the incomplete ones.",
+			run:     cacheCommand,
+		},
+	}
+	for _, c := range commands {
+		c.flags = flag.NewFlagSet(c.name, flag.ExitOnError)
+		c.flags.Usage = c.usage
+		c.flags.StringVar(&o.lang, "lang", "", "Language of the messages ("+strings.Join(i18n.Languages(), ", ")+"). Defaults to the environment's LANG.")
+		c.flags.StringVar(&o.config, "config", "", "Read the settings from this JSON file instead of the default one (see help config).")
+		c.flags.StringVar(&o.workdir, "workdir", "", "Keep the downloads, extractions, logs and inventory in this folder.\nDefaults to device-flasher in the cache and data folders of the user.")
+		switch c.name {
+		case "flash", "unlock", "lock", "ota":
+			c.flags.BoolVar(&o.parallel, "parallel", false, "Work on multiple devices at the same time.")
+			c.flags.IntVar(&o.concurrency, "concurrency", 0, "With -parallel, work on at most this many devices at a time (0 for all).")
+		case "serve":
+			c.flags.IntVar(&o.concurrency, "concurrency", 0, "Flash at most this many devices at a time (0 for all).")
+		}
+		switch c.name {
+		case "devices", "flash", "ota", "verify", "download", "serve", "bundle":
+			c.flags.Var(&o.imagesDirs, "images-dir", "Folder holding the factory and OTA images, as zips or extracted folders. Can be repeated.\nDefaults to the folder of the flasher, or the images of the bundle it runs from.")
+			c.flags.BoolVar(&o.recursive, "recursive", false, "Also look for factory and OTA images in the folders below the images folders.")
+		}
+		switch c.name {
+		case "flash", "unlock", "lock", "ota", "info":
+			c.flags.StringVar(&o.serial, "serial", "", "Only use the device with this serial number.")
+		case "history":
+			c.flags.StringVar(&o.serial, "serial", "", "Only list the device with this serial number.")
+			c.flags.StringVar(&o.tag, "tag", "", "Only list the device with this asset tag.")
+			c.flags.StringVar(&o.codename, "codename", "", "Only list devices with this codename.")
+			c.flags.StringVar(&o.operator, "operator", "", "Only list devices flashed by this operator.")
+			c.flags.StringVar(&o.result, "result", "", "Only list devices with this result (succeeded, failed or canceled).")
+			c.flags.StringVar(&o.since, "since", "", "Only list devices flashed from this date on (YYYY-MM-DD).")
+			c.flags.StringVar(&o.until, "until", "", "Only list devices flashed up to this date (YYYY-MM-DD).")
+			c.flags.BoolVar(&o.csv, "csv", false, "Print CSV instead of text.")
+		}
+		switch c.name {
+		case "flash", "serve":
+			c.flags.StringVar(&o.operator, "operator", "", "Name recorded in the inventory as the operator. Defaults to the current user.")
+			c.flags.BoolVar(&o.requireTag, "require-tag", false, "Only start devices once they have an asset tag, scanned or typed on the dashboard.")
+			c.flags.Var(o.hooks, "hook", "Run a command at a phase of flashing, as phase=command. Can be repeated.\nPhases: "+hookNames()+".\nA failing pre hook stops flashing the device.")
+		}
+		switch c.name {
+		case "flash", "serve", "bundle":
+			c.flags.StringVar(&o.build, "build", "", "Use the factory images of this build ID when several are available, instead of the newest.")
+		}
+		if c.name == "flash" {
+			c.flags.BoolVar(&o.choose, "choose", false, "Choose the factory image of each device when several are available, instead of the newest.")
+			c.flags.StringVar(&o.web, "web", "", "Serve a dashboard at this address (e.g. :8080) to start devices from a browser, instead of prompting on the console.\nOnly reachable from this computer unless a host is given.")
+		}
+		if c.name == "serve" {
+			c.flags.StringVar(&o.listen, "listen", ":8080", "Address to serve at. Only reachable from this computer unless a host is given, e.g. 0.0.0.0:8080.")
+		}
+		switch c.name {
+		case "flash", "serve":
+			c.flags.StringVar(&o.token, "token", "", "Require this token from browsers and API clients, as \"Authorization: Bearer <token>\", a cookie or ?token=<token>. Defaults to DEVICE_FLASHER_TOKEN.")
+		}
+		switch c.name {
+		case "flash":
+			c.flags.StringVar(&o.cleanup, "cleanup", "keep-all", "What to do with the extracted images and platform tools after flashing: keep-all,\nafter-success (remove them once every device succeeded) or keep-last (keep the -keep-last most recently used).")
+			c.flags.IntVar(&o.keepLast, "keep-last", 3, "With -cleanup keep-last, how many extractions to keep.")
+		case "clean":
+			c.flags.IntVar(&o.keepLast, "keep-last", 0, "Keep this many of the most recently used extractions.")
+		case "bundle":
+			c.flags.StringVar(&o.binaries, "binaries", "", "Folder holding the flasher for each OS, as built by make (device-flasher.linux, .darwin and .exe).\nDefaults to the folder of the flasher.")
+		}
+		if c.name == "cache" {
+			c.flags.BoolVar(&o.verify, "verify", false, "With list, hash the extracted files again to find the ones that changed.")
+			c.flags.BoolVar(&o.all, "all", false, "With prune, remove every extraction.")
+		}
+		switch c.name {
+		case "devices", "info", "history", "cache":
+			c.flags.BoolVar(&o.json, "json", false, "Print JSON instead of text, as \"output\": \"json\" in the configuration file does.")
+		}
+	}
+	return commands
+}
+
+func (c *subcommand) usage() {
+	out := c.flags.Output()
+	fmt.Fprintln(out, "Usage: "+strings.TrimSpace(program+" "+c.name+" [flags] "+c.args))
+	fmt.Fprintln(out)
+	fmt.Fprintln(out, c.help)
+	fmt.Fprintln(out)
+	fmt.Fprintln(out, "Flags:")
+	c.flags.PrintDefaults()
+}
+
+func usage(commands []*subcommand) {
+	fmt.Fprintln(os.Stderr, "Usage: "+program+" [command] [flags] [args]")
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "Commands:")
+	w := tabwriter.NewWriter(os.Stderr, 0, 0, 2, ' ', 0)
+	for _, c := range commands {
+		fmt.Fprintf(w, "  %s\t%s\n", c.name, c.summary)
+	}
+	w.Flush()
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "Run '"+program+" help <command>' for the flags of a command.")
+}
+
+// parseCommand picks the subcommand named by the first argument, flash if
+// there is none, and parses its flags.
+func parseCommand(o *options, args []string) (*subcommand, []string) {
+	commands := subcommands(o)
+	name := defaultCommand
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
+	}
+	if name == "help" {
+		for _, c := range commands {
+			if len(args) > 0 && c.name == args[0] {
+				c.flags.SetOutput(os.Stdout)
+				c.usage()
+				os.Exit(0)
+			}
+		}
+		usage(commands)
+		os.Exit(0)
+	}
+	for _, c := range commands {
+		if c.name == name {
+			_ = c.flags.Parse(args)
+			return c, c.flags.Args()
+		}
+	}
+	fmt.Fprintln(os.Stderr, Error("Unknown command "+name))
+	usage(commands)
+	os.Exit(2)
+	return nil, nil
+}
@@ -0,0 +1,242 @@
+// Copyright 2020 CIS Maxwell, LLC. All rights reserved.
+// Copyright 2020 The Calyx Institute
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"gitlab.com/calyxos/device-flasher/device"
+	"gitlab.com/calyxos/device-flasher/flash"
+)
+
+// config holds the settings of a station, read from a JSON file. Flags given
+// on the command line take precedence over it.
+type config struct {
+	// ImagesDirs hold the factory and OTA images, next to the flasher by default.
+	ImagesDirs []string `json:"images_dirs"`
+	// Recursive also looks for factory images in the folders below ImagesDirs.
+	Recursive bool `json:"recursive"`
+	// PlatformToolsMirror is where the platform tools zip is downloaded from in place of Google.
+	PlatformToolsMirror string `json:"platform_tools_mirror"`
+	// Parallel works on all the attached devices, Concurrency of them at a time if set.
+	Parallel    bool `json:"parallel"`
+	Concurrency int  `json:"concurrency"`
+	Timeouts    struct {
+		// Prompt is how many seconds the operator has to confirm each prompt on the device.
+		Prompt int `json:"prompt"`
+		// Device is how many seconds a device may take before it is given up on, if set.
+		Device int `json:"device"`
+	} `json:"timeouts"`
+	// Retries is how many more times a failed download is tried.
+	Retries int `json:"retries"`
+	// Profiles replace the built-in profiles of device models.
+	Profiles map[string]device.Profile `json:"profiles"`
+	Hooks    map[flash.Hook][]string   `json:"hooks"`
+	// Output is auto (dashboard in a terminal), plain (line by line) or json,
+	// which only the commands with a -json flag accept.
+	Output string `json:"output"`
+	Lang   string `json:"lang"`
+	// Workdir holds the downloads, extractions, logs and state.
+	Workdir string `json:"workdir"`
+	// Cleanup is what happens to extractions after flashing: keep-all,
+	// after-success (remove the ones used once every device succeeded) or
+	// keep-last (keep the KeepLast most recently used).
+	Cleanup  string `json:"cleanup"`
+	KeepLast int    `json:"keep_last"`
+}
+
+func defaultConfig() config {
+	c := config{
+		ImagesDirs: []string{defaultImagesDir()},
+		Profiles:   map[string]device.Profile{},
+		Hooks:      map[flash.Hook][]string{},
+		Output:     "auto",
+		Cleanup:    "keep-all",
+		KeepLast:   3,
+	}
+	c.Timeouts.Prompt = 30
+	return c
+}
+
+// configPath returns the configuration file given with the config flag, or
+// device-flasher/config.json in the configuration folder of the user.
+func (o *options) configPath() string {
+	if o.config != "" {
+		return o.config
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "device-flasher", "config.json")
+}
+
+// loadConfig reads the configuration file at path over the defaults. Only a
+// file given explicitly has to exist.
+func loadConfig(path string, explicit bool) (config, error) {
+	c := defaultConfig()
+	if path == "" {
+		return c, nil
+	}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) && !explicit {
+		return c, nil
+	}
+	if err != nil {
+		return c, err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&c); err != nil {
+		return c, fmt.Errorf("%s: %w", path, err)
+	}
+	if err := c.validate(); err != nil {
+		return c, fmt.Errorf("%s: %w", path, err)
+	}
+	return c, nil
+}
+
+func (c *config) validate() error {
+	if len(c.ImagesDirs) == 0 {
+		c.ImagesDirs = []string{defaultImagesDir()}
+	}
+	if c.Profiles == nil {
+		c.Profiles = map[string]device.Profile{}
+	}
+	if c.Hooks == nil {
+		c.Hooks = map[flash.Hook][]string{}
+	}
+	if c.Timeouts.Prompt == 0 {
+		c.Timeouts.Prompt = 30
+	}
+	if c.Output == "" {
+		c.Output = "auto"
+	}
+	switch c.Output {
+	case "auto", "plain", "json":
+	default:
+		return fmt.Errorf("output must be auto, plain or json, not %q", c.Output)
+	}
+	if c.Cleanup == "" {
+		c.Cleanup = "keep-all"
+	}
+	switch c.Cleanup {
+	case "keep-all", "after-success", "keep-last":
+	default:
+		return fmt.Errorf("cleanup must be keep-all, after-success or keep-last, not %q", c.Cleanup)
+	}
+	if c.Concurrency < 0 || c.Retries < 0 || c.Timeouts.Prompt < 0 || c.Timeouts.Device < 0 || c.KeepLast < 0 {
+		return fmt.Errorf("concurrency, retries, timeouts and keep_last cannot be negative")
+	}
+	for hook := range c.Hooks {
+		if !validHook(hook) {
+			return fmt.Errorf("unknown hook %s, expected one of %s", hook, hookNames())
+		}
+	}
+	return nil
+}
+
+func validHook(hook flash.Hook) bool {
+	for _, h := range flash.Hooks {
+		if h == hook {
+			return true
+		}
+	}
+	return false
+}
+
+// configure loads the configuration file, lets the flags set on the command
+// line override it and applies the result.
+func (o *options) configure(flags *flag.FlagSet) error {
+	c, err := loadConfig(o.configPath(), o.config != "")
+	if err != nil {
+		return err
+	}
+	flags.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "images-dir":
+			c.ImagesDirs = o.imagesDirs
+		case "recursive":
+			c.Recursive = o.recursive
+		case "parallel":
+			c.Parallel = o.parallel
+		case "concurrency":
+			c.Concurrency = o.concurrency
+		case "hook":
+			// Hooks given for a phase replace the configured ones
+			for hook, lines := range o.hooks {
+				c.Hooks[hook] = lines
+			}
+		case "json":
+			if o.json {
+				c.Output = "json"
+			}
+		case "lang":
+			c.Lang = o.lang
+		case "workdir":
+			c.Workdir = o.workdir
+		case "cleanup":
+			c.Cleanup = o.cleanup
+		case "keep-last":
+			c.KeepLast = o.keepLast
+		}
+	})
+	if err := c.validate(); err != nil {
+		return err
+	}
+	// config show prints JSON either way
+	if c.Output == "json" && flags.Lookup("json") == nil && flags.Name() != "config" {
+		return fmt.Errorf("output json is only supported by devices, info, history and cache, not %s: set it to auto or plain", flags.Name())
+	}
+	for i, dir := range c.ImagesDirs {
+		if c.ImagesDirs[i], err = filepath.Abs(dir); err != nil {
+			return err
+		}
+	}
+	if c.Workdir != "" {
+		if c.Workdir, err = filepath.Abs(c.Workdir); err != nil {
+			return err
+		}
+	}
+	o.settings = c
+	o.imagesDirs = c.ImagesDirs
+	o.recursive = c.Recursive
+	o.parallel = c.Parallel
+	o.concurrency = c.Concurrency
+	o.hooks = c.Hooks
+	o.json = c.Output == "json" && flags.Lookup("json") != nil
+	o.lang = c.Lang
+	workdir = c.Workdir
+	return nil
+}
+
+func configCommand(o *options, args []string) {
+	if len(args) != 1 || args[0] != "show" {
+		errorln(fmt.Errorf("expected %s config show", program), true)
+	}
+	if _, err := os.Stat(o.configPath()); err == nil {
+		fmt.Println(tr("Configuration file: %s", o.configPath()))
+	} else {
+		fmt.Println(tr("No configuration file at %s, showing the defaults", o.configPath()))
+	}
+	printJSON(o.settings)
+}
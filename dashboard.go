@@ -0,0 +1,388 @@
+// Copyright 2020 CIS Maxwell, LLC. All rights reserved.
+// Copyright 2020 The Calyx Institute
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"gitlab.com/calyxos/device-flasher/device"
+	"gitlab.com/calyxos/device-flasher/flash"
+)
+
+// isTerminal reports whether f is an interactive terminal that understands
+// the escape sequences the dashboard redraws itself with.
+func isTerminal(f *os.File) bool {
+	if os.Getenv("TERM") == "dumb" {
+		return false
+	}
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// each runs fn on every device through flash.Each, within the concurrency and
+// device timeout configured. On a terminal, unless the output is set to plain,
+// progress is shown on a dashboard with one row per device instead of scrolling
+// text, and the output of flash-all and the hooks goes to a log per device,
+// which the row of a device that failed points to.
+func each(o *options, flasher *flash.Flasher, devices []*device.Device, fn func(context.Context, *device.Device) error) map[string]error {
+	if seconds := o.settings.Timeouts.Device; seconds > 0 {
+		run := fn
+		fn = func(ctx context.Context, d *device.Device) error {
+			ctx, cancel := context.WithTimeout(ctx, time.Duration(seconds)*time.Second)
+			defer cancel()
+			err := run(ctx, d)
+			if errors.Is(err, context.DeadlineExceeded) {
+				err = fmt.Errorf("%s timed out after %d seconds: %w", d, seconds, err)
+			}
+			return err
+		}
+	}
+	fn = flash.Limit(o.concurrency, fn)
+	if o.settings.Output == "plain" || !isTerminal(os.Stdout) {
+		return flash.Each(context.Background(), devices, fn)
+	}
+	// Stop on Ctrl+C instead of exiting, so the terminal gets restored
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	defer signal.Stop(interrupt)
+	go func() {
+		select {
+		case <-interrupt:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	dash := newDashboard(os.Stdout, devices)
+	logs := openDeviceLogs(logsDir(), devices)
+	events, stderr, deviceLog := flasher.Events, flasher.Stderr, flasher.DeviceLog
+	flasher.Events, flasher.Stderr, flasher.DeviceLog = dash.event, ioutil.Discard, logs.log
+	defer func() { flasher.Events, flasher.Stderr, flasher.DeviceLog = events, stderr, deviceLog }()
+	dash.start()
+	errs := flash.Each(ctx, devices, fn)
+	logs.close(errs)
+	dash.stop(errs, logs)
+	return errs
+}
+
+// deviceLogs keeps the output of flash-all and the hooks for each device in a
+// file of its own, named like the logs of station mode.
+type deviceLogs struct {
+	files map[string]*os.File
+}
+
+func openDeviceLogs(dir string, devices []*device.Device) *deviceLogs {
+	logs := &deviceLogs{files: map[string]*os.File{}}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return logs
+	}
+	started := time.Now().Format("20060102-150405")
+	for _, d := range devices {
+		if f, err := os.Create(filepath.Join(dir, started+"-"+d.Serial+".log")); err == nil {
+			logs.files[d.Serial] = f
+		}
+	}
+	return logs
+}
+
+// log returns the log of d and its path, or nothing to write to if it could
+// not be created.
+func (logs *deviceLogs) log(d *device.Device) (io.Writer, string) {
+	f, ok := logs.files[d.Serial]
+	if !ok {
+		return ioutil.Discard, ""
+	}
+	return f, f.Name()
+}
+
+// path returns the path of the log of the device with serial, if it has one.
+func (logs *deviceLogs) path(serial string) string {
+	if f, ok := logs.files[serial]; ok {
+		return f.Name()
+	}
+	return ""
+}
+
+// close ends the log of each device with the error it failed with, if any,
+// and removes the empty ones.
+func (logs *deviceLogs) close(errs map[string]error) {
+	for serial, f := range logs.files {
+		if err := errs[serial]; err != nil {
+			fmt.Fprintln(f, flash.Message(err, printer.Sprintf))
+		}
+		info, err := f.Stat()
+		f.Close()
+		if err == nil && info.Size() == 0 {
+			os.Remove(f.Name())
+		}
+	}
+}
+
+// dashboard keeps one row per device on the screen, with the phase it is in,
+// its progress, the time spent on it and what the operator has to do on it.
+type dashboard struct {
+	out     io.Writer
+	mu      sync.Mutex
+	rows    []*row
+	started time.Time
+	done    chan struct{}
+	stopped chan struct{}
+}
+
+type row struct {
+	device *device.Device
+	phase  string
+	// action holds the instructions for the operator, if the device waits on them.
+	action []string
+	// progress is a fraction of the current phase, -1 if it cannot be measured.
+	progress float64
+	finished time.Time
+	failed   bool
+	// log is the log of a device that failed.
+	log string
+}
+
+func newDashboard(out io.Writer, devices []*device.Device) *dashboard {
+	dash := &dashboard{out: out, done: make(chan struct{}), stopped: make(chan struct{})}
+	for _, d := range devices {
+		dash.rows = append(dash.rows, &row{device: d, phase: tr("Waiting"), progress: -1})
+	}
+	return dash
+}
+
+// start switches to the alternate screen and redraws it every second until stop.
+func (dash *dashboard) start() {
+	dash.started = time.Now()
+	fmt.Fprint(dash.out, "\033[?1049h\033[?25l")
+	dash.redraw()
+	go func() {
+		defer close(dash.stopped)
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				dash.redraw()
+			case <-dash.done:
+				return
+			}
+		}
+	}()
+}
+
+// stop marks the devices in errs as failed, pointing to their logs, and the
+// others as done, restores the screen and prints the final state of every row.
+func (dash *dashboard) stop(errs map[string]error, logs *deviceLogs) {
+	close(dash.done)
+	<-dash.stopped
+	dash.mu.Lock()
+	defer dash.mu.Unlock()
+	for _, r := range dash.rows {
+		switch {
+		case errs[r.device.Serial] != nil:
+			r.phase, r.progress, r.failed = tr("Failed"), -1, true
+			r.log = logs.path(r.device.Serial)
+		case r.finished.IsZero():
+			// Unlocking alone has no final reboot to report the device as done
+			r.phase, r.progress = tr("Done"), 1
+		}
+		if r.finished.IsZero() {
+			r.finished = time.Now()
+		}
+		r.action = nil
+	}
+	fmt.Fprint(dash.out, "\033[?25h\033[?1049l")
+	fmt.Fprintln(dash.out)
+	for _, line := range dash.lines() {
+		fmt.Fprintln(dash.out, line)
+	}
+}
+
+func (dash *dashboard) event(e flash.Event) {
+	dash.mu.Lock()
+	var r *row
+	for _, candidate := range dash.rows {
+		if candidate.device.Serial == e.Device.Serial {
+			r = candidate
+		}
+	}
+	if r == nil {
+		dash.mu.Unlock()
+		return
+	}
+	r.phase, r.progress = describe(e)
+	if e.Step == flash.StepDone {
+		r.finished = time.Now()
+	}
+	if e.Action == flash.ActionReconnect {
+		// Reconnecting comes before the unlock confirmation asked for just before
+		r.action = append(instructions(e.Device, e.Action, e.Key), r.action...)
+	} else {
+		r.action = instructions(e.Device, e.Action, e.Key)
+	}
+	dash.mu.Unlock()
+	dash.redraw()
+}
+
+// redraw draws the whole screen from the top left corner, clearing what is
+// left of each line and everything below the last one.
+func (dash *dashboard) redraw() {
+	dash.mu.Lock()
+	defer dash.mu.Unlock()
+	var b strings.Builder
+	b.WriteString("\033[H")
+	b.WriteString(tr("Android Factory Image Flasher version %s", version) + "\033[K\n\033[K\n")
+	for _, line := range dash.lines() {
+		b.WriteString(line + "\033[K\n")
+	}
+	b.WriteString("\033[K\n" + tr("Press Ctrl+C to stop") + "\033[K\n\033[J")
+	fmt.Fprint(dash.out, b.String())
+}
+
+// lines lays out the rows in columns, each followed by its instructions.
+func (dash *dashboard) lines() []string {
+	header := []string{tr("CODENAME"), tr("SERIAL"), tr("PHASE"), tr("PROGRESS"), tr("ELAPSED")}
+	cells := [][]string{header}
+	for _, r := range dash.rows {
+		finished := r.finished
+		if finished.IsZero() {
+			finished = time.Now()
+		}
+		cells = append(cells, []string{r.device.Codename, r.device.Serial, r.phase,
+			progressBar(r.progress), elapsed(finished.Sub(dash.started))})
+	}
+	widths := make([]int, len(header))
+	for _, cell := range cells {
+		for i, s := range cell {
+			if n := utf8.RuneCountInString(s); n > widths[i] {
+				widths[i] = n
+			}
+		}
+	}
+	var lines []string
+	for i, cell := range cells {
+		var line string
+		for j, s := range cell {
+			if j < len(cell)-1 {
+				s += strings.Repeat(" ", widths[j]-utf8.RuneCountInString(s)+2)
+			}
+			if j == 2 && i > 0 {
+				switch r := dash.rows[i-1]; {
+				case r.failed:
+					s = Error(s)
+				case !r.finished.IsZero():
+					s = Blue(s)
+				}
+			}
+			line += s
+		}
+		lines = append(lines, line)
+		if i == 0 {
+			continue
+		}
+		if log := dash.rows[i-1].log; log != "" {
+			lines = append(lines, "  "+tr("Output in %s", log))
+		}
+		marker := " " + tr("ACTION REQUIRED ON THE PHONE") + " "
+		for j, action := range dash.rows[i-1].action {
+			if j == 0 {
+				lines = append(lines, "  "+Highlight(marker)+" "+Warn(action))
+			} else {
+				lines = append(lines, "  "+strings.Repeat(" ", utf8.RuneCountInString(marker))+" "+Warn(action))
+			}
+		}
+	}
+	return lines
+}
+
+func progressBar(fraction float64) string {
+	const width = 20
+	if fraction < 0 {
+		return strings.Repeat(" ", width+7)
+	}
+	if fraction > 1 {
+		fraction = 1
+	}
+	filled := int(fraction * width)
+	return fmt.Sprintf("[%s%s] %3d%%", strings.Repeat("#", filled), strings.Repeat("-", width-filled), int(fraction*100))
+}
+
+func elapsed(d time.Duration) string {
+	seconds := int(d.Seconds())
+	return fmt.Sprintf("%02d:%02d", seconds/60, seconds%60)
+}
+
+// describe names the step e is at, along with the fraction of it that is done,
+// or -1 if that cannot be measured.
+func describe(e flash.Event) (string, float64) {
+	switch e.Step {
+	case flash.StepUnlock:
+		return tr("Waiting for unlock confirmation"), -1
+	case flash.StepUnlockCritical:
+		return tr("Waiting for critical unlock confirmation"), -1
+	case flash.StepFlash:
+		if e.Total > 0 {
+			return tr("Flashing partition %d of %d (%s)", e.Current, e.Total, e.Partition), float64(e.Current) / float64(e.Total)
+		}
+		return tr("Flashing"), -1
+	case flash.StepLock:
+		return tr("Waiting for lock confirmation"), -1
+	case flash.StepReboot:
+		return tr("Rebooting"), -1
+	case flash.StepRebootSideload:
+		return tr("Rebooting into sideload mode"), -1
+	case flash.StepSideload:
+		return tr("Sideloading"), float64(e.Percent) / 100
+	case flash.StepWaitBoot:
+		return tr("Waiting for reboot"), -1
+	case flash.StepDone:
+		return tr("Done"), 1
+	}
+	return tr("Waiting"), -1
+}
+
+// instructions tells the operator what to do on d for action, holding key to
+// reconnect it.
+func instructions(d *device.Device, action flash.Action, key string) []string {
+	switch action {
+	case flash.ActionUnlock:
+		return []string{tr("Please use the volume and power keys on the device to unlock the bootloader")}
+	case flash.ActionReconnect:
+		return []string{
+			tr("Once %s boots, disconnect its cable and power it off", d),
+			tr("Then, hold %s and connect the cable again to boot it into fastboot mode.",
+				keyName(key)),
+		}
+	case flash.ActionUnlockCritical:
+		return []string{tr("Please use the volume and power keys on the device to unlock the bootloader (critical)")}
+	case flash.ActionLock:
+		return []string{tr("Please use the volume and power keys on the device to lock the bootloader")}
+	}
+	return nil
+}
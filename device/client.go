@@ -0,0 +1,281 @@
+// Copyright 2020 CIS Maxwell, LLC. All rights reserved.
+// Copyright 2020 The Calyx Institute
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package device
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gitlab.com/calyxos/device-flasher/command"
+	"gitlab.com/calyxos/device-flasher/parse"
+)
+
+// Client runs adb and fastboot from the given paths through Runner.
+type Client struct {
+	ADB      string
+	Fastboot string
+	Runner   command.Runner
+	// Profiles replace the built-in profiles of device models, for models
+	// added or changed since this release.
+	Profiles map[string]Profile
+}
+
+func NewClient(adb, fastboot string) *Client {
+	return &Client{ADB: adb, Fastboot: fastboot, Runner: command.Exec{}}
+}
+
+// Profile returns the profile of a device model, from Profiles or the
+// built-in ones.
+func (c *Client) Profile(codename string) Profile {
+	if p, ok := c.Profiles[codename]; ok {
+		return p
+	}
+	return LookupProfile(codename)
+}
+
+func (c *Client) adb(ctx context.Context, args ...string) (command.Result, error) {
+	return c.Runner.Run(ctx, command.Cmd{Argv: append([]string{c.ADB}, args...)})
+}
+
+func (c *Client) fastboot(ctx context.Context, args ...string) (command.Result, error) {
+	return c.Runner.Run(ctx, command.Cmd{Argv: append([]string{c.Fastboot}, args...)})
+}
+
+func (c *Client) StartServer(ctx context.Context) error {
+	_, err := c.adb(ctx, "start-server")
+	return err
+}
+
+func (c *Client) KillServer(ctx context.Context) error {
+	_, err := c.adb(ctx, "kill-server")
+	return err
+}
+
+// Devices lists the devices attached through adb and fastboot, with their codenames.
+func (c *Client) Devices(ctx context.Context) ([]*Device, error) {
+	devices, err := c.Attached(ctx)
+	for _, d := range devices {
+		c.Identify(ctx, d)
+	}
+	return devices, err
+}
+
+// Attached lists the devices attached through adb and fastboot without
+// querying them, so only the codenames adb reports are filled in. When adb
+// or fastboot fails, the devices the other one found are returned along with
+// the error.
+func (c *Client) Attached(ctx context.Context) ([]*Device, error) {
+	var devices []*Device
+	adbDevices, adbErr := c.adbDevices(ctx)
+	for _, attached := range adbDevices {
+		devices = append(devices, &Device{Serial: attached.Serial, Mode: ADB, Codename: attached.Attrs["device"]})
+	}
+	fastbootDevices, fastbootErr := c.fastbootDevices(ctx)
+	for _, attached := range fastbootDevices {
+		devices = append(devices, &Device{Serial: attached.Serial, Mode: Fastboot})
+	}
+	switch {
+	case adbErr != nil && fastbootErr != nil:
+		return devices, fmt.Errorf("adb devices: %v; fastboot devices: %w", adbErr, fastbootErr)
+	case adbErr != nil:
+		return devices, fmt.Errorf("adb devices: %w", adbErr)
+	case fastbootErr != nil:
+		return devices, fmt.Errorf("fastboot devices: %w", fastbootErr)
+	}
+	return devices, nil
+}
+
+func (c *Client) adbDevices(ctx context.Context) ([]parse.Device, error) {
+	result, err := c.adb(ctx, "devices", "-l")
+	if err != nil {
+		return nil, err
+	}
+	return parse.ADBDevices(result.Stdout)
+}
+
+func (c *Client) fastbootDevices(ctx context.Context) ([]parse.Device, error) {
+	result, err := c.fastboot(ctx, "devices")
+	if err != nil {
+		return nil, err
+	}
+	return parse.FastbootDevices(result.Stdout)
+}
+
+// Identify asks d for its codename if it is not known yet, and reads its
+// bootloader state in fastboot mode.
+func (c *Client) Identify(ctx context.Context, d *Device) {
+	switch d.Mode {
+	case ADB:
+		if d.Codename == "" {
+			d.Codename, _ = c.GetProp(ctx, d.Serial, "ro.product.device")
+		}
+	case Fastboot:
+		var err error
+		if d.Info, err = c.Info(ctx, d.Serial); err == nil {
+			d.Codename = d.Info.Codename()
+		}
+	}
+}
+
+// FastbootCommand runs fastboot with args against serial and parses its response.
+func (c *Client) FastbootCommand(ctx context.Context, serial string, args ...string) (*parse.FastbootResponse, error) {
+	result, runErr := c.fastboot(ctx, append([]string{"-s", serial}, args...)...)
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	// A FAIL explains more than the exit status that comes with it
+	response, err := parse.Fastboot(result.Combined())
+	if err != nil {
+		return response, err
+	}
+	return response, runErr
+}
+
+// $ fastboot getvar prop
+// prop: value
+// Finished. Total time: 0.002s
+func (c *Client) GetVar(ctx context.Context, serial, prop string) (string, error) {
+	response, err := c.FastbootCommand(ctx, serial, "getvar", prop)
+	if err != nil {
+		return "", err
+	}
+	return response.Var(prop)
+}
+
+// $ fastboot flashing get_unlock_ability
+// (bootloader) get_unlock_ability: 0
+// OKAY [  0.000s]
+// Finished. Total time: 0.000s
+func (c *Client) GetUnlockAbility(ctx context.Context, serial string) (string, error) {
+	response, err := c.FastbootCommand(ctx, serial, "flashing", "get_unlock_ability")
+	if err != nil {
+		return "", err
+	}
+	return response.Var("get_unlock_ability")
+}
+
+// $ fastboot oem device-info
+// (bootloader) Verity mode: false
+// (bootloader) Device unlocked: true
+// (bootloader) Device critical unlocked: true
+// (bootloader) Charger screen enabled: false
+// OKAY [  0.000s]
+// Finished. Total time: 0.000s
+func (c *Client) GetCriticalUnlocked(ctx context.Context, serial string) (string, error) {
+	response, err := c.FastbootCommand(ctx, serial, "oem", "device-info")
+	if err != nil {
+		return "", err
+	}
+	return response.Var("Device critical unlocked")
+}
+
+// LockState refreshes d.Info and reports whether its bootloader is locked.
+func (c *Client) LockState(ctx context.Context, d *Device) (LockState, error) {
+	info, err := c.Info(ctx, d.Serial)
+	if err != nil {
+		return LockStateUnknown, err
+	}
+	d.Info = info
+	return info.LockState(c.Profile(d.Codename)), nil
+}
+
+func (c *Client) GetProp(ctx context.Context, serial, prop string) (string, error) {
+	result, err := c.adb(ctx, "-s", serial, "shell", "getprop", prop)
+	if err != nil {
+		return "", err
+	}
+	return strings.Trim(string(result.Stdout), "[]\n\r"), nil
+}
+
+// $ adb -s serial get-state
+// sideload
+func (c *Client) GetState(ctx context.Context, serial string) (string, error) {
+	result, err := c.adb(ctx, "-s", serial, "get-state")
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(result.Stdout)), nil
+}
+
+// RebootBootloader reboots a device running Android into fastboot mode.
+func (c *Client) RebootBootloader(ctx context.Context, serial string) error {
+	_, err := c.adb(ctx, "-s", serial, "reboot", "bootloader")
+	return err
+}
+
+// RebootSideload reboots a device running Android into recovery, ready to sideload
+// an OTA, rebooting again on its own once the OTA is installed.
+func (c *Client) RebootSideload(ctx context.Context, serial string) error {
+	_, err := c.adb(ctx, "-s", serial, "reboot", "sideload-auto-reboot")
+	return err
+}
+
+// The flashing commands below may wait for confirmation on the device until ctx
+// is done; callers check the lock state to see whether they went through.
+
+func (c *Client) Unlock(ctx context.Context, serial string) error {
+	_, err := c.fastboot(ctx, "-s", serial, "flashing", "unlock")
+	return err
+}
+
+func (c *Client) UnlockCritical(ctx context.Context, serial string) error {
+	_, err := c.fastboot(ctx, "-s", serial, "flashing", "unlock_critical")
+	return err
+}
+
+func (c *Client) Lock(ctx context.Context, serial string) error {
+	_, err := c.fastboot(ctx, "-s", serial, "flashing", "lock")
+	return err
+}
+
+func (c *Client) Reboot(ctx context.Context, serial string) error {
+	_, err := c.fastboot(ctx, "-s", serial, "reboot")
+	return err
+}
+
+// Sideload sends an OTA zip to a device in sideload mode, calling progress with
+// the percentage sent so far.
+func (c *Client) Sideload(ctx context.Context, serial, otaZip string, progress func(percent int)) error {
+	_, err := c.Runner.Run(ctx, command.Cmd{
+		Argv:   []string{c.ADB, "-s", serial, "sideload", otaZip},
+		Stdout: &sideloadWriter{progress: progress},
+	})
+	return err
+}
+
+// $ adb sideload ota.zip
+// serving: 'ota.zip'  (~47%)
+var sideloadProgress = regexp.MustCompile(`\(~(\d+)%\)`)
+
+type sideloadWriter struct {
+	progress func(percent int)
+	percent  int
+}
+
+func (sw *sideloadWriter) Write(p []byte) (int, error) {
+	matches := sideloadProgress.FindAllSubmatch(p, -1)
+	if len(matches) > 0 {
+		percent, _ := strconv.Atoi(string(matches[len(matches)-1][1]))
+		if percent != sw.percent && sw.progress != nil {
+			sw.percent = percent
+			sw.progress(percent)
+		}
+	}
+	return len(p), nil
+}
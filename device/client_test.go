@@ -0,0 +1,87 @@
+// Copyright 2020 CIS Maxwell, LLC. All rights reserved.
+// Copyright 2020 The Calyx Institute
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package device
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"gitlab.com/calyxos/device-flasher/command"
+)
+
+func TestAttached(t *testing.T) {
+	adbOut := "List of devices attached\n0A091FDD4002S4         device usb:1-1 product:redfin model:Pixel_5 device:redfin transport_id:1\n\n"
+	fastbootOut := "8A2X0KQ4B\tfastboot\n"
+	failed := errors.New("exit status 1")
+	tests := []struct {
+		name        string
+		adbErr      error
+		fastbootErr error
+		devices     []*Device
+		err         bool
+	}{
+		{
+			name: "both",
+			devices: []*Device{
+				{Serial: "0A091FDD4002S4", Mode: ADB, Codename: "redfin"},
+				{Serial: "8A2X0KQ4B", Mode: Fastboot},
+			},
+		},
+		{
+			name:    "adb fails",
+			adbErr:  failed,
+			devices: []*Device{{Serial: "8A2X0KQ4B", Mode: Fastboot}},
+			err:     true,
+		},
+		{
+			name:        "fastboot fails",
+			fastbootErr: failed,
+			devices:     []*Device{{Serial: "0A091FDD4002S4", Mode: ADB, Codename: "redfin"}},
+			err:         true,
+		},
+		{
+			name:        "both fail",
+			adbErr:      failed,
+			fastbootErr: failed,
+			err:         true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c := &Client{ADB: "adb", Fastboot: "fastboot", Runner: command.RunnerFunc(func(ctx context.Context, cmd command.Cmd) (command.Result, error) {
+				if cmd.Argv[0] == "adb" {
+					if test.adbErr != nil {
+						return command.Result{}, test.adbErr
+					}
+					return command.Result{Stdout: []byte(adbOut)}, nil
+				}
+				if test.fastbootErr != nil {
+					return command.Result{}, test.fastbootErr
+				}
+				return command.Result{Stdout: []byte(fastbootOut)}, nil
+			})}
+			devices, err := c.Attached(context.Background())
+			if (err != nil) != test.err {
+				t.Errorf("Attached() error = %v, want error %v", err, test.err)
+			}
+			if !reflect.DeepEqual(devices, test.devices) {
+				t.Errorf("Attached() = %v, want %v", devices, test.devices)
+			}
+		})
+	}
+}
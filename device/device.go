@@ -0,0 +1,47 @@
+// Copyright 2020 CIS Maxwell, LLC. All rights reserved.
+// Copyright 2020 The Calyx Institute
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package device talks to phones through adb and fastboot.
+package device
+
+// Mode is the platform tool a device is currently reachable through.
+type Mode string
+
+const (
+	ADB      Mode = "adb"
+	Fastboot Mode = "fastboot"
+)
+
+// Device is a phone attached over USB.
+type Device struct {
+	Serial   string `json:"serial"`
+	Codename string `json:"codename"`
+	Mode     Mode   `json:"mode"`
+	// Info is the last state read from the device in fastboot mode.
+	Info *Info `json:"info,omitempty"`
+}
+
+func (d *Device) String() string {
+	return d.Codename + " " + d.Serial
+}
+
+// LockState is the state of a device's bootloader as reported by fastboot.
+type LockState int
+
+const (
+	LockStateUnknown LockState = iota
+	Locked
+	Unlocked
+)
@@ -0,0 +1,152 @@
+// Copyright 2020 CIS Maxwell, LLC. All rights reserved.
+// Copyright 2020 The Calyx Institute
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package device
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gitlab.com/calyxos/device-flasher/parse"
+)
+
+// Info is the state a device in fastboot mode reports through getvar all.
+type Info struct {
+	Serial      string `json:"serial"`
+	Product     string `json:"product"`
+	Variant     string `json:"variant,omitempty"`
+	SlotCount   int    `json:"slot_count"`
+	CurrentSlot string `json:"current_slot,omitempty"`
+	// Unlocked is the raw getvar unlocked (yes/no), SecureState the getvar
+	// securestate used instead on Motorola devices (flashing_locked/flashing_unlocked).
+	Unlocked          string      `json:"unlocked,omitempty"`
+	SecureState       string      `json:"securestate,omitempty"`
+	BootloaderVersion string      `json:"version_bootloader,omitempty"`
+	BasebandVersion   string      `json:"version_baseband,omitempty"`
+	MaxDownloadSize   uint64      `json:"max_download_size"`
+	BatteryVoltage    int         `json:"battery_voltage,omitempty"`
+	BatterySocOk      string      `json:"battery_soc_ok,omitempty"`
+	IsUserspace       bool        `json:"is_userspace"`
+	Partitions        []Partition `json:"partitions,omitempty"`
+	// Vars holds every variable reported, including the ones above.
+	Vars map[string]string `json:"vars"`
+}
+
+// Partition is an entry of the partition table reported by getvar all.
+type Partition struct {
+	Name    string `json:"name"`
+	Size    uint64 `json:"size"`
+	Type    string `json:"type,omitempty"`
+	Logical bool   `json:"logical"`
+}
+
+// Codename returns the device codename matching the reported product.
+func (i *Info) Codename() string {
+	if i.Product == "sdm845" {
+		return "axolotl"
+	}
+	return i.Product
+}
+
+// LockState interprets Unlocked or, for profiles that need it, SecureState.
+func (i *Info) LockState(profile Profile) LockState {
+	state := i.Unlocked
+	if profile.SecureState {
+		state = strings.TrimPrefix(i.SecureState, "flashing_")
+	}
+	switch state {
+	case "no", "locked":
+		return Locked
+	case "yes", "unlocked":
+		return Unlocked
+	}
+	return LockStateUnknown
+}
+
+// Info reads the state of a device in fastboot mode with a single getvar all.
+func (c *Client) Info(ctx context.Context, serial string) (*Info, error) {
+	response, err := c.FastbootCommand(ctx, serial, "getvar", "all")
+	if err != nil {
+		return nil, err
+	}
+	return NewInfo(response), nil
+}
+
+// NewInfo builds an Info from a parsed getvar all response.
+//
+//	(bootloader) serialno:0A091FDD4002S4
+//	(bootloader) product:redfin
+//	(bootloader) variant:MSM USF
+//	(bootloader) slot-count:2
+//	(bootloader) current-slot:a
+//	(bootloader) unlocked:no
+//	(bootloader) version-bootloader:r3-0.4-7617406
+//	(bootloader) version-baseband:g7250-00188-220211-B-8174514
+//	(bootloader) max-download-size:0x10000000
+//	(bootloader) battery-voltage:4301
+//	(bootloader) battery-soc-ok:yes
+//	(bootloader) is-userspace:no
+//	(bootloader) partition-size:abl_a:0x800000
+//	(bootloader) partition-type:abl_a:raw
+//	(bootloader) is-logical:system_a:yes
+func NewInfo(response *parse.FastbootResponse) *Info {
+	vars := response.Vars
+	i := &Info{
+		Serial:            vars["serialno"],
+		Product:           vars["product"],
+		Variant:           vars["variant"],
+		CurrentSlot:       strings.TrimPrefix(vars["current-slot"], "_"),
+		Unlocked:          vars["unlocked"],
+		SecureState:       vars["securestate"],
+		BootloaderVersion: vars["version-bootloader"],
+		BasebandVersion:   vars["version-baseband"],
+		BatterySocOk:      vars["battery-soc-ok"],
+		IsUserspace:       vars["is-userspace"] == "yes",
+		Vars:              vars,
+	}
+	i.SlotCount, _ = strconv.Atoi(vars["slot-count"])
+	i.MaxDownloadSize, _ = strconv.ParseUint(vars["max-download-size"], 0, 64)
+	i.BatteryVoltage, _ = strconv.Atoi(strings.TrimRight(vars["battery-voltage"], " mV"))
+	partitions := map[string]*Partition{}
+	partition := func(name string) *Partition {
+		if _, ok := partitions[name]; !ok {
+			partitions[name] = &Partition{Name: name}
+		}
+		return partitions[name]
+	}
+	for key, value := range vars {
+		kv := strings.SplitN(key, ":", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		switch kv[0] {
+		case "partition-size":
+			partition(kv[1]).Size, _ = strconv.ParseUint(value, 0, 64)
+		case "partition-type":
+			partition(kv[1]).Type = value
+		case "is-logical":
+			partition(kv[1]).Logical = value == "yes"
+		}
+	}
+	for _, p := range partitions {
+		i.Partitions = append(i.Partitions, *p)
+	}
+	sort.Slice(i.Partitions, func(a, b int) bool {
+		return i.Partitions[a].Name < i.Partitions[b].Name
+	})
+	return i
+}
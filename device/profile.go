@@ -0,0 +1,75 @@
+// Copyright 2020 CIS Maxwell, LLC. All rights reserved.
+// Copyright 2020 The Calyx Institute
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package device
+
+// Profile describes how a device model behaves while its bootloader is unlocked and locked.
+type Profile struct {
+	// SecureState devices report their lock state through getvar securestate instead of getvar unlocked.
+	SecureState bool `json:"secure_state,omitempty"`
+	// Reconnect devices boot Android after unlocking and have to be brought back into fastboot mode by hand.
+	Reconnect bool `json:"reconnect,omitempty"`
+	// ReconnectKey is held while reconnecting the cable to boot into fastboot mode.
+	ReconnectKey string `json:"reconnect_key,omitempty"`
+	// CriticalUnlock devices also need fastboot flashing unlock_critical.
+	CriticalUnlock bool `json:"critical_unlock,omitempty"`
+	// UnlockAbility devices are only locked while fastboot flashing get_unlock_ability returns 1.
+	UnlockAbility bool `json:"unlock_ability,omitempty"`
+	// UncertainLock devices cannot always report their lock state after locking.
+	UncertainLock bool `json:"uncertain_lock,omitempty"`
+}
+
+var motorola = Profile{SecureState: true}
+
+var profiles = map[string]Profile{
+	"devon":  motorola,
+	"hawao":  motorola,
+	"rhode":  motorola,
+	"bangkk": motorola,
+	"fogo":   motorola,
+	"fogos":  motorola,
+	"FP4": {
+		Reconnect:      true,
+		ReconnectKey:   "volume down",
+		CriticalUnlock: true,
+		UnlockAbility:  true,
+		UncertainLock:  true,
+	},
+	"FP5": {
+		Reconnect:      true,
+		ReconnectKey:   "volume down",
+		CriticalUnlock: true,
+		UnlockAbility:  true,
+		UncertainLock:  true,
+	},
+	"axolotl": {
+		Reconnect:     true,
+		ReconnectKey:  "volume up",
+		UncertainLock: true,
+	},
+	"otter": {
+		Reconnect:      true,
+		ReconnectKey:   "volume up",
+		CriticalUnlock: true,
+		UncertainLock:  true,
+	},
+}
+
+// LookupProfile returns the built-in profile of a device model, or the zero
+// Profile for models that need no special handling. Client.Profile also
+// considers the profiles configured on the client.
+func LookupProfile(codename string) Profile {
+	return profiles[codename]
+}
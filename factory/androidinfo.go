@@ -0,0 +1,178 @@
+// Copyright 2020 CIS Maxwell, LLC. All rights reserved.
+// Copyright 2020 The Calyx Institute
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package factory
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// AndroidInfo holds the requirements android-info.txt puts on the devices a
+// factory image can be installed on, which fastboot update enforces:
+//
+//	require board=redfin
+//	require version-bootloader=r3-0.5-10191384
+//	require version-baseband=g7250-00267-230531-B-10234713
+type AndroidInfo struct {
+	Requirements []Requirement
+}
+
+// Requirement is a line of android-info.txt.
+type Requirement struct {
+	// Var is the variable the device reports through getvar, board standing for product.
+	Var string
+	// Values are the values allowed, a trailing * matching any suffix.
+	Values []string
+	// Reject turns the requirement around: Var must have none of Values.
+	Reject bool
+	// Product, if set, limits the requirement to the devices reporting this product.
+	Product string
+}
+
+// ParseAndroidInfo parses the content of android-info.txt.
+func ParseAndroidInfo(r io.Reader) (*AndroidInfo, error) {
+	info := &AndroidInfo{}
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.SplitN(line, " ", 2)
+		kv := []string{""}
+		if len(fields) == 2 {
+			kv = strings.SplitN(strings.TrimSpace(fields[1]), "=", 2)
+		}
+		if len(kv) != 2 || kv[0] == "" {
+			return nil, fmt.Errorf("android-info.txt line %d: expected require name=value, got %q", n, line)
+		}
+		requirement := Requirement{Var: kv[0], Values: strings.Split(kv[1], "|")}
+		switch {
+		case fields[0] == "require":
+		case fields[0] == "reject":
+			requirement.Reject = true
+		case strings.HasPrefix(fields[0], "require-for-product:"):
+			requirement.Product = strings.TrimPrefix(fields[0], "require-for-product:")
+		default:
+			return nil, fmt.Errorf("android-info.txt line %d: unknown %s", n, fields[0])
+		}
+		info.Requirements = append(info.Requirements, requirement)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+// ReadAndroidInfo parses the android-info.txt of an extracted factory image.
+func ReadAndroidInfo(folder string) (*AndroidInfo, error) {
+	f, err := os.Open(filepath.Join(folder, "android-info.txt"))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ParseAndroidInfo(f)
+}
+
+// Board returns the first board required, the codename of the device, if any.
+func (a *AndroidInfo) Board() string {
+	for _, r := range a.Requirements {
+		if r.Var == "board" && !r.Reject && r.Product == "" {
+			return r.Values[0]
+		}
+	}
+	return ""
+}
+
+// Mismatches lists the requirements a device reporting vars through getvar
+// does not meet, skipping the variables in installed, which flash-all sets
+// itself before fastboot update checks them. Variables the device does not
+// report are left to fastboot update.
+func (a *AndroidInfo) Mismatches(vars map[string]string, installed ...string) []string {
+	var mismatches []string
+	for _, r := range a.Requirements {
+		name := r.Var
+		if name == "board" {
+			name = "product"
+		}
+		value, reported := vars[name]
+		if !reported || contains(installed, r.Var) || (r.Product != "" && r.Product != vars["product"]) {
+			continue
+		}
+		if matches(r.Values, value) == r.Reject {
+			verb := "requires"
+			if r.Reject {
+				verb = "rejects"
+			}
+			mismatches = append(mismatches, fmt.Sprintf("the image %s %s %s, the device reports %s",
+				verb, r.Var, strings.Join(r.Values, " or "), value))
+		}
+	}
+	return mismatches
+}
+
+func matches(patterns []string, value string) bool {
+	for _, pattern := range patterns {
+		if pattern == value || (strings.HasSuffix(pattern, "*") && strings.HasPrefix(value, strings.TrimSuffix(pattern, "*"))) {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// Compatible checks that the factory image extracted to folder can be installed
+// on a device reporting vars through getvar, explaining every requirement it
+// does not meet. The bootloader and baseband versions only have to match when
+// the image does not come with the bootloader and radio images flash-all
+// installs first.
+func Compatible(folder string, vars map[string]string) error {
+	info, err := ReadAndroidInfo(folder)
+	if err != nil {
+		return err
+	}
+	var installed []string
+	for name, variable := range map[string]string{"bootloader": "version-bootloader", "radio": "version-baseband"} {
+		if images, _ := filepath.Glob(filepath.Join(folder, name+"-*.img")); len(images) > 0 {
+			installed = append(installed, variable)
+		}
+	}
+	if mismatches := info.Mismatches(vars, installed...); len(mismatches) > 0 {
+		return &IncompatibleError{Mismatches: mismatches}
+	}
+	return nil
+}
+
+// IncompatibleError lists the requirements of a factory image a device does not meet.
+type IncompatibleError struct {
+	Mismatches []string
+}
+
+func (e *IncompatibleError) Error() string {
+	return strings.Join(e.Mismatches, "; ")
+}
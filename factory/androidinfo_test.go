@@ -0,0 +1,210 @@
+// Copyright 2020 CIS Maxwell, LLC. All rights reserved.
+// Copyright 2020 The Calyx Institute
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package factory
+
+import (
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// redfinInfo is the android-info.txt of redfin-tq3a.230805.001.
+const redfinInfo = `require board=redfin
+require version-bootloader=r3-0.5-10191384
+require version-baseband=g7250-00267-230531-B-10234713
+`
+
+// redfinVars are what a redfin that runs that build reports through getvar.
+var redfinVars = map[string]string{
+	"product":            "redfin",
+	"version-bootloader": "r3-0.5-10191384",
+	"version-baseband":   "g7250-00267-230531-B-10234713",
+}
+
+// with returns vars with the values in changes, dropping the empty ones.
+func with(vars map[string]string, changes ...string) map[string]string {
+	changed := map[string]string{}
+	for name, value := range vars {
+		changed[name] = value
+	}
+	for i := 0; i+1 < len(changes); i += 2 {
+		if changes[i+1] == "" {
+			delete(changed, changes[i])
+		} else {
+			changed[changes[i]] = changes[i+1]
+		}
+	}
+	return changed
+}
+
+func TestMismatches(t *testing.T) {
+	tests := []struct {
+		name       string
+		info       string
+		vars       map[string]string
+		installed  []string
+		mismatches []string
+	}{
+		{
+			name: "same device and versions",
+			info: redfinInfo,
+			vars: redfinVars,
+		},
+		{
+			name:       "other device",
+			info:       redfinInfo,
+			vars:       with(redfinVars, "product", "bramble"),
+			mismatches: []string{"the image requires board redfin, the device reports bramble"},
+		},
+		{
+			name: "other bootloader and baseband",
+			info: redfinInfo,
+			vars: with(redfinVars, "version-bootloader", "r3-0.5-9999999", "version-baseband", "g7250-00000"),
+			mismatches: []string{
+				"the image requires version-bootloader r3-0.5-10191384, the device reports r3-0.5-9999999",
+				"the image requires version-baseband g7250-00267-230531-B-10234713, the device reports g7250-00000",
+			},
+		},
+		{
+			name:      "bootloader and baseband installed by flash-all",
+			info:      redfinInfo,
+			vars:      with(redfinVars, "version-bootloader", "r3-0.5-9999999", "version-baseband", "g7250-00000"),
+			installed: []string{"version-bootloader", "version-baseband"},
+		},
+		{
+			name: "variable not reported",
+			info: redfinInfo,
+			vars: with(redfinVars, "version-baseband", ""),
+		},
+		{
+			name: "one of several values",
+			info: "require board=sunfish|sunfish_eea\nrequire version-bootloader=s5-0.5-10043446|s5-0.5-10191384\n",
+			vars: map[string]string{"product": "sunfish", "version-bootloader": "s5-0.5-10191384"},
+		},
+		{
+			name: "none of several values",
+			info: "require board=sunfish|sunfish_eea\nrequire version-bootloader=s5-0.5-10043446|s5-0.5-10191384\n",
+			vars: map[string]string{"product": "sunfish", "version-bootloader": "s5-0.4-7617406"},
+			mismatches: []string{
+				"the image requires version-bootloader s5-0.5-10043446 or s5-0.5-10191384, the device reports s5-0.4-7617406",
+			},
+		},
+		{
+			name: "prefix",
+			info: "require board=FP4\nrequire version-bootloader=FP4.*\n",
+			vars: map[string]string{"product": "FP4", "version-bootloader": "FP4.TP1B"},
+		},
+		{
+			name: "rejected value",
+			info: "require board=angler\nreject version-bootloader=angler-01.*|angler-02.*\n",
+			vars: map[string]string{"product": "angler", "version-bootloader": "angler-02.45"},
+			mismatches: []string{
+				"the image rejects version-bootloader angler-01.* or angler-02.*, the device reports angler-02.45",
+			},
+		},
+		{
+			name: "value not rejected",
+			info: "require board=angler\nreject version-bootloader=angler-01.*|angler-02.*\n",
+			vars: map[string]string{"product": "angler", "version-bootloader": "angler-03.84"},
+		},
+		{
+			name: "requirement for this product",
+			info: "require board=shamu\nrequire-for-product:shamu version-baseband=MDM9625_104662.22.05.34R\n",
+			vars: map[string]string{"product": "shamu", "version-baseband": "MDM9625_104446.01.02.95R"},
+			mismatches: []string{
+				"the image requires version-baseband MDM9625_104662.22.05.34R, the device reports MDM9625_104446.01.02.95R",
+			},
+		},
+		{
+			name: "requirement for another product",
+			info: "require board=shamu|shamu_eea\nrequire-for-product:shamu version-baseband=MDM9625_104662.22.05.34R\n",
+			vars: map[string]string{"product": "shamu_eea", "version-baseband": "MDM9625_104446.01.02.95R"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			info, err := ParseAndroidInfo(strings.NewReader(test.info))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if mismatches := info.Mismatches(test.vars, test.installed...); !reflect.DeepEqual(mismatches, test.mismatches) {
+				t.Errorf("Mismatches() = %q, want %q", mismatches, test.mismatches)
+			}
+		})
+	}
+}
+
+func TestParseAndroidInfo(t *testing.T) {
+	tests := []struct {
+		name  string
+		info  string
+		board string
+		err   bool
+	}{
+		{name: "pixel", info: redfinInfo, board: "redfin"},
+		{name: "comments and blank lines", info: "# Generated\n\nrequire board=FP4\r\n", board: "FP4"},
+		{name: "first board", info: "require board=sunfish|sunfish_eea\n", board: "sunfish"},
+		{name: "product only", info: "require-for-product:shamu board=shamu\n"},
+		{name: "no value", info: "require board\n", err: true},
+		{name: "no variable", info: "require =redfin\n", err: true},
+		{name: "unknown", info: "prefer board=redfin\n", err: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			info, err := ParseAndroidInfo(strings.NewReader(test.info))
+			if (err != nil) != test.err {
+				t.Fatalf("ParseAndroidInfo() = %v, want error %v", err, test.err)
+			}
+			if err == nil && info.Board() != test.board {
+				t.Errorf("Board() = %q, want %q", info.Board(), test.board)
+			}
+		})
+	}
+}
+
+func TestCompatible(t *testing.T) {
+	folder := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(folder, "android-info.txt"), []byte(redfinInfo), 0644); err != nil {
+		t.Fatal(err)
+	}
+	outdated := with(redfinVars, "version-bootloader", "r3-0.5-9999999")
+	err := Compatible(folder, outdated)
+	var incompatible *IncompatibleError
+	if !errors.As(err, &incompatible) || len(incompatible.Mismatches) != 1 {
+		t.Fatalf("Compatible() = %v, want an IncompatibleError with one mismatch", err)
+	}
+	if err := Compatible(folder, with(redfinVars, "product", "bramble", "version-bootloader", "r3-0.5-9999999")); !errors.As(err, &incompatible) || len(incompatible.Mismatches) != 2 {
+		t.Errorf("Compatible() = %v, want an IncompatibleError with two mismatches", err)
+	}
+
+	// flash-all installs the bootloader that comes with the image first
+	if err := ioutil.WriteFile(filepath.Join(folder, "bootloader-redfin-r3-0.5-10191384.img"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := Compatible(folder, outdated); err != nil {
+		t.Errorf("Compatible() = %v with the bootloader image, want nil", err)
+	}
+	if err := Compatible(folder, with(redfinVars, "product", "bramble")); !errors.As(err, &incompatible) {
+		t.Errorf("Compatible() = %v for another device, want an IncompatibleError", err)
+	}
+
+	if err := Compatible(t.TempDir(), redfinVars); err == nil || errors.As(err, &incompatible) {
+		t.Errorf("Compatible() = %v without android-info.txt, want an error reading it", err)
+	}
+}
@@ -0,0 +1,439 @@
+// Copyright 2020 CIS Maxwell, LLC. All rights reserved.
+// Copyright 2020 The Calyx Institute
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package factory finds the factory images and OTA zips available for flashing.
+package factory
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gitlab.com/calyxos/device-flasher/cache"
+	"gitlab.com/calyxos/device-flasher/internal/archive"
+	"gitlab.com/calyxos/device-flasher/internal/disk"
+	"gitlab.com/calyxos/device-flasher/progress"
+)
+
+// ImageInfo describes a factory image, as read from its content and name.
+type ImageInfo struct {
+	// Path is the factory zip, or the folder it was extracted to.
+	Path     string `json:"path"`
+	Codename string `json:"codename"`
+	BuildID  string `json:"build_id,omitempty"`
+	// Date is the date in the build ID, or else when the image was built.
+	Date time.Time `json:"date"`
+	// Channel is the release channel named in the file name, if any.
+	Channel string `json:"channel,omitempty"`
+
+	// number is the build number ending the file name, such as 23110200 in
+	// redfin-factory-23110200.zip, and modified when the file was last changed.
+	// They order images of the same build ID.
+	number   uint64
+	modified time.Time
+}
+
+// Channels are the release channels recognized in file names.
+var Channels = []string{"stable", "beta", "security-express", "testing"}
+
+// Scan maps device codenames to the factory images in dirs, and in the folders
+// below them if recursive, newest first. A factory image is either a zip or a
+// folder one was extracted to, holding flash-all and android-info.txt:
+//
+//	redfin-factory-23110200.zip
+//	  redfin-tq3a.230805.001/
+//	    android-info.txt
+//	    flash-all.sh
+//	    image-redfin-tq3a.230805.001.zip
+//
+// Codenames and build IDs are read from the name of the image-*.zip inside,
+// or else from the folder name and the board android-info.txt requires.
+func Scan(dirs []string, recursive bool) (map[string][]ImageInfo, error) {
+	return scanAll(dirs, recursive, false)
+}
+
+// scanAll maps device codenames to the factory images in dirs, or to the OTA
+// zips if ota, newest first.
+func scanAll(dirs []string, recursive, ota bool) (map[string][]ImageInfo, error) {
+	images := map[string][]ImageInfo{}
+	seen := map[string]bool{}
+	add := func(image ImageInfo) {
+		// OTAs can update more than one model
+		key := image.Codename + "/" + image.Path
+		if !seen[key] {
+			seen[key] = true
+			images[image.Codename] = append(images[image.Codename], image)
+		}
+	}
+	for _, dir := range dirs {
+		if err := scan(dir, recursive, ota, add); err != nil {
+			return nil, err
+		}
+	}
+	sortNewest(images)
+	return images, nil
+}
+
+// sortNewest sorts the images of each codename, newest first.
+func sortNewest(images map[string][]ImageInfo) {
+	for _, candidates := range images {
+		sort.SliceStable(candidates, func(i, j int) bool {
+			return newer(candidates[i], candidates[j])
+		})
+	}
+}
+
+// newer reports whether a is newer than b: by the date of their build IDs,
+// then by the build numbers in their file names, then by when the files were
+// last changed.
+func newer(a, b ImageInfo) bool {
+	switch {
+	case !a.Date.Equal(b.Date):
+		return a.Date.After(b.Date)
+	case a.BuildID != b.BuildID:
+		return a.BuildID > b.BuildID
+	case a.number != b.number:
+		return a.number > b.number
+	default:
+		return a.modified.After(b.modified)
+	}
+}
+
+// Find maps device codenames to their newest factory image, as found by Scan,
+// without extracting them.
+func Find(dirs []string, recursive bool) (map[string]string, error) {
+	candidates, err := Scan(dirs, recursive)
+	if err != nil {
+		return nil, err
+	}
+	images := map[string]string{}
+	for codename, found := range candidates {
+		images[codename] = found[0].Path
+	}
+	return images, nil
+}
+
+// scan adds the factory images in dir, or the OTA zips (codename-ota-*.zip) if
+// ota, and those in the folders below it if recursive.
+func scan(dir string, recursive, ota bool, add func(ImageInfo)) error {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	// Folders the zips next to them extract to are left to the zips, which get extracted again
+	extractedTo := map[string]bool{}
+	var folders []string
+	for _, file := range files {
+		path := filepath.Join(dir, file.Name())
+		if file.IsDir() {
+			// Hidden folders include the ones extractions in progress write to
+			if !strings.HasPrefix(file.Name(), ".") {
+				folders = append(folders, path)
+			}
+			continue
+		}
+		if !strings.HasSuffix(file.Name(), ".zip") {
+			continue
+		}
+		if ota {
+			if !strings.Contains(file.Name(), "-ota-") {
+				continue
+			}
+			images, err := otaInfo(path)
+			if err != nil {
+				return fmt.Errorf("%s: %w", file.Name(), err)
+			}
+			for _, image := range images {
+				image.modified = file.ModTime()
+				add(image)
+			}
+			continue
+		}
+		image, top, err := zipInfo(path)
+		if err != nil {
+			// Only complain about zips meant to be factory images, other zips such as OTAs and the platform tools live here too
+			if strings.Contains(file.Name(), "factory") {
+				return fmt.Errorf("%s: %w", file.Name(), err)
+			}
+			continue
+		}
+		extractedTo[filepath.Join(dir, top)] = true
+		image.modified = file.ModTime()
+		add(image)
+	}
+	for _, folder := range folders {
+		switch {
+		case extractedTo[folder]:
+		case isExtracted(folder):
+			if ota {
+				continue
+			}
+			image, err := folderInfo(folder)
+			if err != nil {
+				return fmt.Errorf("%s: %w", folder, err)
+			}
+			add(image)
+		case recursive:
+			if err := scan(folder, recursive, ota, add); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// isExtracted reports whether folder holds an extracted factory image.
+func isExtracted(folder string) bool {
+	if _, err := os.Stat(filepath.Join(folder, "android-info.txt")); err != nil {
+		return false
+	}
+	for _, script := range []string{"flash-all.sh", "flash-all.bat"} {
+		if _, err := os.Stat(filepath.Join(folder, script)); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// zipInfo describes a factory zip, and returns the top folder it extracts to.
+func zipInfo(file string) (ImageInfo, string, error) {
+	r, err := zip.OpenReader(file)
+	if err != nil {
+		return ImageInfo{}, "", err
+	}
+	defer r.Close()
+	var info *zip.File
+	var top, image string
+	for _, f := range r.File {
+		parts := strings.Split(f.Name, "/")
+		if len(parts) != 2 {
+			continue
+		}
+		switch {
+		case strings.HasPrefix(parts[1], "image-") && strings.HasSuffix(parts[1], ".zip"):
+			top, image = parts[0], parts[1]
+		case parts[1] == "android-info.txt":
+			top, info = parts[0], f
+		}
+	}
+	if info == nil {
+		return ImageInfo{}, "", errors.New("not a factory image")
+	}
+	rc, err := info.Open()
+	if err != nil {
+		return ImageInfo{}, "", err
+	}
+	defer rc.Close()
+	i, err := describe(file, top, image, rc, info.Modified)
+	return i, top, err
+}
+
+// folderInfo describes an extracted factory image.
+func folderInfo(folder string) (ImageInfo, error) {
+	var image string
+	if images, _ := filepath.Glob(filepath.Join(folder, "image-*.zip")); len(images) > 0 {
+		image = filepath.Base(images[0])
+	}
+	f, err := os.Open(filepath.Join(folder, "android-info.txt"))
+	if err != nil {
+		return ImageInfo{}, err
+	}
+	defer f.Close()
+	stat, err := f.Stat()
+	if err != nil {
+		return ImageInfo{}, err
+	}
+	i, err := describe(folder, filepath.Base(folder), image, f, stat.ModTime())
+	i.modified = stat.ModTime()
+	return i, err
+}
+
+// describe fills in the ImageInfo of the factory image at path from the name
+// of its folder (codename-build), of its image-codename-build.zip, if any, and
+// of its android-info.txt, built at modified.
+func describe(path, folder, image string, androidInfo io.Reader, modified time.Time) (ImageInfo, error) {
+	i := ImageInfo{Path: path, Date: modified}
+	if image != "" {
+		i.Codename, i.BuildID = splitBuild(strings.TrimSuffix(strings.TrimPrefix(image, "image-"), ".zip"))
+	} else {
+		info, err := ParseAndroidInfo(androidInfo)
+		if err != nil {
+			return i, err
+		}
+		board := info.Board()
+		if board == "" {
+			return i, errors.New("no board in android-info.txt")
+		}
+		i.Codename = board
+		if strings.HasPrefix(folder, board+"-") {
+			i.BuildID = strings.TrimPrefix(folder, board+"-")
+		}
+	}
+	if date, ok := buildDate(i.BuildID); ok {
+		i.Date = date
+	}
+	i.number = buildNumber(path)
+	name := strings.ToLower(filepath.Base(path))
+	for _, channel := range Channels {
+		if strings.Contains(name, channel) {
+			i.Channel = channel
+			break
+		}
+	}
+	return i, nil
+}
+
+// splitBuild splits codename-build, such as redfin-tq3a.230805.001.
+func splitBuild(name string) (codename, build string) {
+	if i := strings.LastIndex(name, "-"); i > 0 {
+		return name[:i], name[i+1:]
+	}
+	return name, ""
+}
+
+// buildNumber returns the number ending the name of file, such as 23110200 in
+// redfin-factory-23110200.zip, or 0.
+func buildNumber(file string) uint64 {
+	name := strings.TrimSuffix(filepath.Base(file), ".zip")
+	number, err := strconv.ParseUint(name[strings.LastIndex(name, "-")+1:], 10, 64)
+	if err != nil {
+		return 0
+	}
+	return number
+}
+
+// buildDate returns the date in a build ID such as TQ3A.230805.001.
+func buildDate(build string) (time.Time, bool) {
+	fields := strings.Split(build, ".")
+	if len(fields) < 2 || len(fields[1]) != 6 {
+		return time.Time{}, false
+	}
+	date, err := time.Parse("060102", fields[1])
+	return date, err == nil
+}
+
+// Extract extracts the factory zips among images into the cache, or next to
+// them if it is nil, and maps the codenames to the folders of all images.
+// Images that Validate finds problems with are not extracted or used.
+func Extract(images map[string]string, c *cache.Cache, report progress.Func) (map[string]string, error) {
+	if err := checkSpace(images, c); err != nil {
+		return nil, err
+	}
+	folders := map[string]string{}
+	for device, file := range images {
+		folder := file
+		if info, err := os.Stat(file); err == nil && !info.IsDir() {
+			if err := check(file, false); err != nil {
+				return nil, err
+			}
+			dir := filepath.Dir(file)
+			if c != nil {
+				dir, err = c.Extract(file, report)
+			} else {
+				_, err = archive.Extract(file, dir, report)
+			}
+			if err != nil {
+				return nil, err
+			}
+			_, top, err := zipInfo(file)
+			if err != nil {
+				return nil, err
+			}
+			folder = filepath.Join(dir, top)
+		}
+		if err := check(folder, true); err != nil {
+			return nil, err
+		}
+		folders[device] = folder
+	}
+	return folders, nil
+}
+
+// checkSpace makes sure that all the zips among images that Extract would
+// extract fit where they go, before any of them is extracted.
+func checkSpace(images map[string]string, c *cache.Cache) error {
+	needed := map[string]uint64{}
+	for _, file := range images {
+		if info, err := os.Stat(file); err != nil || info.IsDir() || (c != nil && c.Extracted(file)) {
+			continue
+		}
+		size, err := archive.Size(file)
+		if err != nil {
+			return err
+		}
+		dir := filepath.Dir(file)
+		if c != nil {
+			dir = c.Dir
+		}
+		needed[dir] += size
+	}
+	for dir, size := range needed {
+		if err := disk.Check(dir, size); err != nil {
+			return fmt.Errorf("cannot extract the factory images: %w", err)
+		}
+	}
+	return nil
+}
+
+func check(path string, inner bool) error {
+	report, err := validate(path, inner)
+	if err != nil {
+		return err
+	}
+	return report.Err()
+}
+
+// Verify checks that every file in a zip reads back intact and, when a
+// <zip>.sha256 or <zip>.sha256sum file sits next to it, that the zip matches
+// the sum it holds. For an extracted factory image folder, the image-*.zip
+// inside is checked.
+func Verify(file string) error {
+	if info, err := os.Stat(file); err == nil && info.IsDir() {
+		images, err := filepath.Glob(filepath.Join(file, "image-*.zip"))
+		if err != nil {
+			return err
+		}
+		for _, image := range images {
+			if err := archive.Check(image); err != nil {
+				return fmt.Errorf("%s: %w", filepath.Base(image), err)
+			}
+		}
+		return nil
+	}
+	for _, ext := range []string{".sha256", ".sha256sum"} {
+		content, err := ioutil.ReadFile(file + ext)
+		if err != nil {
+			continue
+		}
+		// sha256sum format: <sum>  <file>
+		fields := strings.Fields(string(content))
+		if len(fields) == 0 {
+			return fmt.Errorf("%s is empty", filepath.Base(file+ext))
+		}
+		if err := archive.Verify(file, strings.ToLower(fields[0])); err != nil {
+			return err
+		}
+		break
+	}
+	return archive.Check(file)
+}
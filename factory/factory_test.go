@@ -0,0 +1,170 @@
+// Copyright 2020 CIS Maxwell, LLC. All rights reserved.
+// Copyright 2020 The Calyx Institute
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package factory
+
+import (
+	"archive/zip"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// writeFactoryZip writes a factory zip of build for redfin, changed at modified.
+func writeFactoryZip(t *testing.T, file, build string, modified time.Time) {
+	t.Helper()
+	f, err := os.Create(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := zip.NewWriter(f)
+	top := "redfin-" + build + "/"
+	for _, name := range []string{top + "android-info.txt", top + "flash-all.sh", top + "image-redfin-" + build + ".zip"} {
+		if _, err := w.Create(name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(file, modified, modified); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestScanOrder(t *testing.T) {
+	old := time.Date(2023, 11, 2, 0, 0, 0, 0, time.UTC)
+	recent := old.AddDate(0, 0, 19)
+	type file struct {
+		name     string
+		build    string
+		modified time.Time
+	}
+	tests := []struct {
+		name   string
+		zips   []file
+		newest string
+	}{
+		{
+			name: "build date",
+			zips: []file{
+				{"redfin-factory-23110200.zip", "tq3a.230805.001", recent},
+				{"redfin-factory-23112100.zip", "tq3a.230901.001", old},
+			},
+			newest: "redfin-factory-23112100.zip",
+		},
+		{
+			name: "build number",
+			zips: []file{
+				{"redfin-factory-23112100.zip", "tq3a.230805.001", old},
+				{"redfin-factory-23110200.zip", "tq3a.230805.001", recent},
+			},
+			newest: "redfin-factory-23112100.zip",
+		},
+		{
+			name: "modification time",
+			zips: []file{
+				{"redfin-factory-beta.zip", "tq3a.230805.001", old},
+				{"redfin-factory-stable.zip", "tq3a.230805.001", recent},
+			},
+			newest: "redfin-factory-stable.zip",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for _, f := range test.zips {
+				writeFactoryZip(t, filepath.Join(dir, f.name), f.build, f.modified)
+			}
+			images, err := Scan([]string{dir}, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(images["redfin"]) != len(test.zips) {
+				t.Fatalf("found %v, want %d images", images, len(test.zips))
+			}
+			if newest := filepath.Base(images["redfin"][0].Path); newest != test.newest {
+				t.Errorf("newest is %s, want %s", newest, test.newest)
+			}
+		})
+	}
+}
+
+// writeOTAZip writes an OTA zip with metadata, changed at modified.
+func writeOTAZip(t *testing.T, file, metadata string, modified time.Time) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Create(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := zip.NewWriter(f)
+	entry, err := w.Create("META-INF/com/android/metadata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := entry.Write([]byte(metadata)); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(file, modified, modified); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDiscoverOTA(t *testing.T) {
+	dir := t.TempDir()
+	modified := time.Date(2023, 11, 2, 0, 0, 0, 0, time.UTC)
+	writeOTAZip(t, filepath.Join(dir, "calyxos-ota-23110200.zip"),
+		"post-build=google/redfin/redfin:14/UP1A.231005.007/23110200:user/release-keys\npre-device=redfin\n", modified)
+	writeOTAZip(t, filepath.Join(dir, "stable", "calyxos-ota-23112100.zip"),
+		"post-build=google/redfin/redfin:14/UP1A.231005.007/23112100:user/release-keys\npre-device=redfin\n", modified)
+	writeOTAZip(t, filepath.Join(dir, "stable", "FP4-ota-23110200.zip"),
+		"post-build=Fairphone/FP4/FP4:14/UQ1A.231205.015/23110200:user/release-keys\npre-device=FP4|FP4eea\n", modified)
+
+	otas, err := DiscoverOTA([]string{dir}, false, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"redfin": filepath.Join(dir, "calyxos-ota-23110200.zip")}
+	if !reflect.DeepEqual(otas, want) {
+		t.Errorf("DiscoverOTA() = %v, want %v", otas, want)
+	}
+
+	otas, err = DiscoverOTA([]string{dir}, true, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = map[string]string{
+		"redfin": filepath.Join(dir, "stable", "calyxos-ota-23112100.zip"),
+		"FP4":    filepath.Join(dir, "stable", "FP4-ota-23110200.zip"),
+		"FP4eea": filepath.Join(dir, "stable", "FP4-ota-23110200.zip"),
+	}
+	if !reflect.DeepEqual(otas, want) {
+		t.Errorf("DiscoverOTA() with recursive = %v, want %v", otas, want)
+	}
+}
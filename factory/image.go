@@ -0,0 +1,62 @@
+// Copyright 2020 CIS Maxwell, LLC. All rights reserved.
+// Copyright 2020 The Calyx Institute
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package factory
+
+import (
+	"archive/zip"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Partitions lists the partitions flash-all writes from an extracted factory
+// image folder: the bootloader and radio images next to it, followed by the
+// images inside image-*.zip that fastboot update writes.
+//
+//	redfin-tq3a.230805.001/
+//	  bootloader-redfin-r3-0.5-10191384.img
+//	  radio-redfin-g7250-00267-230531-b-10234713.img
+//	  image-redfin-tq3a.230805.001.zip: boot.img, dtbo.img, vendor_boot.img, ...
+func Partitions(folder string) ([]string, error) {
+	var partitions []string
+	for _, name := range []string{"bootloader", "radio"} {
+		if matches, _ := filepath.Glob(filepath.Join(folder, name+"-*.img")); len(matches) > 0 {
+			partitions = append(partitions, name)
+		}
+	}
+	images, err := filepath.Glob(filepath.Join(folder, "image-*.zip"))
+	if err != nil {
+		return nil, err
+	}
+	for _, image := range images {
+		r, err := zip.OpenReader(image)
+		if err != nil {
+			return nil, err
+		}
+		var names []string
+		for _, f := range r.File {
+			name := filepath.Base(f.Name)
+			// super_empty.img only describes the layout of the logical partitions.
+			if strings.HasSuffix(name, ".img") && name != "super_empty.img" {
+				names = append(names, strings.TrimSuffix(name, ".img"))
+			}
+		}
+		r.Close()
+		sort.Strings(names)
+		partitions = append(partitions, names...)
+	}
+	return partitions, nil
+}
@@ -0,0 +1,161 @@
+// Copyright 2020 CIS Maxwell, LLC. All rights reserved.
+// Copyright 2020 The Calyx Institute
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package factory
+
+import (
+	"archive/zip"
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DiscoverOTA maps device codenames to the newest OTA zip (codename-ota-*.zip)
+// in dirs, and in the folders below them if recursive. OTA zips are sideloaded
+// as they are, so they are only located, not extracted. Zips given explicitly
+// take the place of the ones found in dirs. The models an OTA updates are read
+// from its metadata.
+func DiscoverOTA(dirs []string, recursive bool, zips []string) (map[string]string, error) {
+	var candidates map[string][]ImageInfo
+	if len(zips) == 0 {
+		var err error
+		if candidates, err = scanAll(dirs, recursive, true); err != nil {
+			return nil, err
+		}
+	} else {
+		candidates = map[string][]ImageInfo{}
+		for _, file := range zips {
+			stat, err := os.Stat(file)
+			if err != nil {
+				return nil, err
+			}
+			images, err := otaInfo(file)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", filepath.Base(file), err)
+			}
+			for _, image := range images {
+				image.modified = stat.ModTime()
+				candidates[image.Codename] = append(candidates[image.Codename], image)
+			}
+		}
+		sortNewest(candidates)
+	}
+	otas := map[string]string{}
+	for codename, found := range candidates {
+		otas[codename] = found[0].Path
+	}
+	return otas, nil
+}
+
+// otaInfo describes an OTA zip for each model it updates, from its metadata:
+//
+//	META-INF/com/android/metadata:
+//	post-build=google/redfin/redfin:12/SP1A.210812.016.C1/7897254:user/release-keys
+//	post-timestamp=1628796000
+//	pre-device=redfin
+func otaInfo(file string) ([]ImageInfo, error) {
+	metadata, err := otaMetadata(file)
+	if err != nil {
+		return nil, err
+	}
+	if metadata["pre-device"] == "" {
+		return nil, errors.New("no pre-device in OTA metadata")
+	}
+	i := ImageInfo{Path: file, number: buildNumber(file)}
+	if fingerprint := metadata["post-build"]; fingerprint != "" {
+		if i.BuildID, err = fingerprintBuildID(fingerprint); err != nil {
+			return nil, err
+		}
+	}
+	if date, ok := buildDate(i.BuildID); ok {
+		i.Date = date
+	} else if timestamp, err := strconv.ParseInt(metadata["post-timestamp"], 10, 64); err == nil {
+		i.Date = time.Unix(timestamp, 0).UTC()
+	}
+	name := strings.ToLower(filepath.Base(file))
+	for _, channel := range Channels {
+		if strings.Contains(name, channel) {
+			i.Channel = channel
+			break
+		}
+	}
+	var images []ImageInfo
+	// Models are separated by |
+	for _, codename := range strings.Split(metadata["pre-device"], "|") {
+		i.Codename = codename
+		images = append(images, i)
+	}
+	return images, nil
+}
+
+// OTABuildID returns the build ID an OTA zip updates to, from the post-build
+// fingerprint of its metadata.
+func OTABuildID(otaZip string) (string, error) {
+	metadata, err := otaMetadata(otaZip)
+	if err != nil {
+		return "", err
+	}
+	if metadata["post-build"] == "" {
+		return "", errors.New("no post-build fingerprint in OTA metadata")
+	}
+	return fingerprintBuildID(metadata["post-build"])
+}
+
+// fingerprintBuildID returns the build ID in a fingerprint such as
+// google/redfin/redfin:12/SP1A.210812.016.C1/7897254:user/release-keys.
+func fingerprintBuildID(fingerprint string) (string, error) {
+	// brand/product/device:release/id/incremental:type/tags
+	release := strings.SplitN(fingerprint, ":", 2)
+	fields := strings.Split(release[len(release)-1], "/")
+	if len(release) != 2 || len(fields) < 3 {
+		return "", errors.New("malformed post-build fingerprint " + fingerprint)
+	}
+	return fields[1], nil
+}
+
+// otaMetadata reads the key=value lines of META-INF/com/android/metadata in
+// an OTA zip.
+func otaMetadata(otaZip string) (map[string]string, error) {
+	r, err := zip.OpenReader(otaZip)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	for _, f := range r.File {
+		if f.Name != "META-INF/com/android/metadata" {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+		defer rc.Close()
+		metadata := map[string]string{}
+		scanner := bufio.NewScanner(rc)
+		for scanner.Scan() {
+			if i := strings.Index(scanner.Text(), "="); i > 0 {
+				metadata[scanner.Text()[:i]] = scanner.Text()[i+1:]
+			}
+		}
+		return metadata, scanner.Err()
+	}
+	return nil, errors.New("no metadata in OTA zip")
+}
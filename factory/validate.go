@@ -0,0 +1,320 @@
+// Copyright 2020 CIS Maxwell, LLC. All rights reserved.
+// Copyright 2020 The Calyx Institute
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package factory
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// Report is what Validate found wrong with a factory image. Problems keep it
+// from being flashed, Warnings may not.
+type Report struct {
+	Image    string
+	Problems []string
+	Warnings []string
+}
+
+func (r *Report) problem(format string, args ...interface{}) {
+	r.Problems = append(r.Problems, fmt.Sprintf(format, args...))
+}
+
+func (r *Report) warn(format string, args ...interface{}) {
+	r.Warnings = append(r.Warnings, fmt.Sprintf(format, args...))
+}
+
+// Err returns the Problems as an error, or nil if there are none.
+func (r *Report) Err() error {
+	if len(r.Problems) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%s is not a valid factory image: %s", filepath.Base(r.Image), strings.Join(r.Problems, "; "))
+}
+
+// imageContents are the images fastboot update cannot do without in image-*.zip.
+var imageContents = []string{"android-info.txt", "boot.img", "system.img", "vbmeta.img"}
+
+// Validate checks the layout of a factory zip, or of the folder it was
+// extracted to: a single folder holding flash-all.sh and flash-all.bat,
+// android-info.txt, the bootloader and radio images, and an image-*.zip with
+// the images fastboot update writes. Reading the image zip inside a factory
+// zip takes going through it when it is compressed.
+func Validate(path string) (*Report, error) {
+	return validate(path, true)
+}
+
+// validate checks path as Validate does, leaving out the contents of the image
+// zip inside factory zips unless inner is set.
+func validate(path string, inner bool) (*Report, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return validateFolder(path)
+	}
+	return validateZip(path, inner)
+}
+
+func validateZip(path string, inner bool) (*Report, error) {
+	report := &Report{Image: path}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	stat, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	r, err := zip.NewReader(f, stat.Size())
+	if err != nil {
+		return nil, err
+	}
+	tops := map[string]bool{}
+	files := map[string]*zip.File{}
+	for _, file := range r.File {
+		parts := strings.SplitN(strings.TrimSuffix(file.Name, "/"), "/", 2)
+		tops[parts[0]] = true
+		switch {
+		case len(parts) == 1 && !file.FileInfo().IsDir():
+			report.problem("%s is outside of the image folder", file.Name)
+		case len(parts) == 2 && strings.Contains(parts[1], "/"):
+			report.warn("unexpected %s", file.Name)
+		case len(parts) == 2:
+			files[parts[1]] = file
+		}
+	}
+	if len(tops) != 1 {
+		report.problem("expected a single folder, found %d entries at the top", len(tops))
+	}
+	var names []string
+	for name := range files {
+		names = append(names, name)
+	}
+	androidInfo := func() (*AndroidInfo, error) {
+		rc, err := files["android-info.txt"].Open()
+		if err != nil {
+			return nil, err
+		}
+		defer rc.Close()
+		return ParseAndroidInfo(rc)
+	}
+	checkFolder(report, names, androidInfo)
+	if inner {
+		for name, file := range files {
+			if isImageZip(name) {
+				contents, err := zipNames(f, file)
+				if err != nil {
+					report.problem("cannot read %s: %v", name, err)
+					continue
+				}
+				checkImage(report, name, contents)
+			}
+		}
+	}
+	return report, nil
+}
+
+func validateFolder(folder string) (*Report, error) {
+	report := &Report{Image: folder}
+	entries, err := ioutil.ReadDir(folder)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, entry := range entries {
+		if entry.IsDir() {
+			report.warn("unexpected folder %s", entry.Name())
+			continue
+		}
+		names = append(names, entry.Name())
+	}
+	checkFolder(report, names, func() (*AndroidInfo, error) { return ReadAndroidInfo(folder) })
+	for _, name := range names {
+		if isImageZip(name) {
+			r, err := zip.OpenReader(filepath.Join(folder, name))
+			if err != nil {
+				report.problem("cannot read %s: %v", name, err)
+				continue
+			}
+			var contents []string
+			for _, file := range r.File {
+				contents = append(contents, file.Name)
+			}
+			r.Close()
+			checkImage(report, name, contents)
+		}
+	}
+	return report, nil
+}
+
+// checkFolder checks the files at the top of an image folder.
+func checkFolder(report *Report, names []string, androidInfo func() (*AndroidInfo, error)) {
+	has := map[string]bool{}
+	var images []string
+	for _, name := range names {
+		has[name] = true
+		switch {
+		case name == "android-info.txt", name == "flash-all.sh", name == "flash-all.bat", name == "flash-base.sh":
+		case strings.HasPrefix(name, "bootloader-") && strings.HasSuffix(name, ".img"):
+			has["bootloader"] = true
+		case strings.HasPrefix(name, "radio-") && strings.HasSuffix(name, ".img"):
+			has["radio"] = true
+		case isImageZip(name):
+			images = append(images, name)
+		default:
+			report.warn("unexpected %s", name)
+		}
+	}
+	script := "flash-all.sh"
+	if runtime.GOOS == "windows" {
+		script = "flash-all.bat"
+	}
+	for _, name := range []string{"flash-all.sh", "flash-all.bat"} {
+		switch {
+		case has[name]:
+		case name == script:
+			report.problem("%s is missing", name)
+		default:
+			report.warn("%s is missing", name)
+		}
+	}
+	if !has["android-info.txt"] {
+		report.problem("android-info.txt is missing")
+	} else if info, err := androidInfo(); err != nil {
+		report.problem("%v", err)
+	} else {
+		for _, r := range info.Requirements {
+			name := map[string]string{"version-bootloader": "bootloader", "version-baseband": "radio"}[r.Var]
+			if name != "" && !r.Reject && r.Product == "" && !has[name] {
+				report.warn("no %s image, devices have to run %s %s already", name, r.Var, strings.Join(r.Values, " or "))
+			}
+		}
+	}
+	switch len(images) {
+	case 0:
+		report.problem("image-*.zip is missing")
+	case 1:
+	default:
+		report.problem("expected a single image-*.zip, found %s", strings.Join(images, ", "))
+	}
+}
+
+// checkImage checks the contents of image-*.zip.
+func checkImage(report *Report, name string, contents []string) {
+	has := map[string]bool{}
+	for _, file := range contents {
+		has[file] = true
+		if strings.Contains(file, "/") || !(strings.HasSuffix(file, ".img") || strings.HasSuffix(file, ".txt")) {
+			report.warn("unexpected %s in %s", file, name)
+		}
+	}
+	for _, file := range imageContents {
+		if !has[file] {
+			report.problem("%s is missing from %s", file, name)
+		}
+	}
+}
+
+func isImageZip(name string) bool {
+	return strings.HasPrefix(name, "image-") && strings.HasSuffix(name, ".zip")
+}
+
+// zipNames lists the files in the zip stored as file in the zip read from r.
+// A compressed zip is read through, keeping the end where its contents are listed.
+func zipNames(r io.ReaderAt, file *zip.File) ([]string, error) {
+	size := int64(file.UncompressedSize64)
+	var contents io.ReaderAt
+	if file.Method == zip.Store {
+		offset, err := file.DataOffset()
+		if err != nil {
+			return nil, err
+		}
+		contents = io.NewSectionReader(r, offset, size)
+	} else {
+		rc, err := file.Open()
+		if err != nil {
+			return nil, err
+		}
+		end, err := readEnd(rc, 16<<20)
+		rc.Close()
+		if err != nil {
+			return nil, err
+		}
+		contents = &zipEnd{data: end, size: size}
+	}
+	zr, err := zip.NewReader(contents, size)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, f := range zr.File {
+		names = append(names, f.Name)
+	}
+	return names, nil
+}
+
+// readEnd reads r through and returns its last n bytes.
+func readEnd(r io.Reader, n int) ([]byte, error) {
+	buf := make([]byte, 0, 2*n)
+	chunk := make([]byte, 256<<10)
+	for {
+		read, err := r.Read(chunk)
+		buf = append(buf, chunk[:read]...)
+		if len(buf) > 2*n-len(chunk) {
+			buf = append(buf[:0], buf[len(buf)-n:]...)
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(buf) > n {
+		buf = buf[len(buf)-n:]
+	}
+	return buf, nil
+}
+
+// zipEnd reads the end of a zip of size, which is all listing its files needs.
+type zipEnd struct {
+	data []byte
+	size int64
+}
+
+func (z *zipEnd) ReadAt(p []byte, off int64) (int, error) {
+	start := z.size - int64(len(z.data))
+	if off < start {
+		return 0, errors.New("too many files to list")
+	}
+	if off >= z.size {
+		return 0, io.EOF
+	}
+	n := copy(p, z.data[off-start:])
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
@@ -0,0 +1,71 @@
+// Copyright 2020 CIS Maxwell, LLC. All rights reserved.
+// Copyright 2020 The Calyx Institute
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package flash
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Error is a failure of the sequence reported to the operator. Format is an
+// English message for fmt.Sprintf with Args, which callers may look up in a
+// message catalog to translate it; Err, if set, is what caused it.
+type Error struct {
+	Format string
+	Args   []interface{}
+	Err    error
+}
+
+func errorf(err error, format string, args ...interface{}) *Error {
+	return &Error{Format: format, Args: args, Err: err}
+}
+
+func (e *Error) Error() string {
+	return e.Message(fmt.Sprintf)
+}
+
+// Message formats e with sprintf, through which Format can be translated,
+// followed by the cause.
+func (e *Error) Message(sprintf func(format string, args ...interface{}) string) string {
+	message := sprintf(e.Format, e.Args...)
+	if e.Err != nil {
+		message += ": " + e.Err.Error()
+	}
+	return message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// sprintf formats the messages of f with Sprintf, or fmt.Sprintf.
+func (f *Flasher) sprintf(format string, args ...interface{}) string {
+	if f.Sprintf != nil {
+		return f.Sprintf(format, args...)
+	}
+	return fmt.Sprintf(format, args...)
+}
+
+// Message returns the text of err, with the message of the Error it holds, if
+// any, formatted by sprintf.
+func Message(err error, sprintf func(format string, args ...interface{}) string) string {
+	var e *Error
+	if !errors.As(err, &e) {
+		return err.Error()
+	}
+	return strings.Replace(err.Error(), e.Error(), e.Message(sprintf), 1)
+}
@@ -0,0 +1,65 @@
+// Copyright 2020 CIS Maxwell, LLC. All rights reserved.
+// Copyright 2020 The Calyx Institute
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package flash
+
+import "gitlab.com/calyxos/device-flasher/device"
+
+// Step is a stage of the flashing or sideloading sequence.
+type Step string
+
+const (
+	StepUnlock         Step = "unlock"
+	StepUnlockCritical Step = "unlock-critical"
+	StepFlash          Step = "flash"
+	StepLock           Step = "lock"
+	StepReboot         Step = "reboot"
+	StepRebootSideload Step = "reboot-sideload"
+	StepSideload       Step = "sideload"
+	StepWaitBoot       Step = "wait-boot"
+	StepDone           Step = "done"
+)
+
+// Action is something the operator has to do on the device for a step to go through.
+type Action string
+
+const (
+	ActionNone Action = ""
+	// ActionUnlock asks to confirm unlocking with the volume and power keys.
+	ActionUnlock Action = "unlock"
+	// ActionReconnect asks to power the device off once it boots and reconnect it
+	// while holding the profile's ReconnectKey.
+	ActionReconnect Action = "reconnect"
+	// ActionUnlockCritical asks to confirm the critical unlock with the volume and power keys.
+	ActionUnlockCritical Action = "unlock-critical"
+	// ActionLock asks to confirm locking with the volume and power keys.
+	ActionLock Action = "lock"
+)
+
+// Event reports the progress of a device through the sequence.
+type Event struct {
+	Device *device.Device
+	Step   Step
+	Action Action
+	// Key is the key to hold for ActionReconnect.
+	Key string
+	// Percent is the progress of StepSideload.
+	Percent int
+	// Partition is the partition flash-all is writing during StepFlash, the
+	// Current of Total it knows about.
+	Partition string
+	Current   int
+	Total     int
+}
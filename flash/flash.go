@@ -0,0 +1,434 @@
+// Copyright 2020 CIS Maxwell, LLC. All rights reserved.
+// Copyright 2020 The Calyx Institute
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package flash runs the unlock, flash and lock sequence on attached devices.
+package flash
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sync"
+	"time"
+
+	"gitlab.com/calyxos/device-flasher/command"
+	"gitlab.com/calyxos/device-flasher/device"
+	"gitlab.com/calyxos/device-flasher/factory"
+)
+
+// Flasher installs factory images and OTAs on devices through Client.
+type Flasher struct {
+	Client *device.Client
+	// Runner runs flash-all, the client's Runner by default.
+	Runner command.Runner
+	// Images maps device codenames to extracted factory image folders.
+	Images map[string]string
+	// OTAs maps device codenames to OTA zips.
+	OTAs map[string]string
+	// ToolsPath is put in front of PATH for flash-all, so it uses the same fastboot.
+	ToolsPath string
+	// Version is passed to flash-all as DEVICE_FLASHER_VERSION.
+	Version string
+	// Interval is how long the operator has to confirm each prompt on the device.
+	Interval time.Duration
+	// Events, if set, is called as devices move through the sequence.
+	Events func(Event)
+	// Stderr receives the output of flash-all.
+	Stderr io.Writer
+	// SkipLock leaves the bootloader unlocked at the end of Flash.
+	SkipLock bool
+	// Hooks maps points of the Flash sequence to the commands run there.
+	Hooks map[Hook][]string
+	// LogPath is where the output of the sequence ends up, for hooks.
+	LogPath string
+	// DeviceLog, if set, returns the writer and the path of the log of a
+	// device, which take the place of Stderr and LogPath for it.
+	DeviceLog func(d *device.Device) (io.Writer, string)
+	// Sprintf, if set, formats the messages written to Stderr, which are in
+	// English, so that they can be translated.
+	Sprintf func(format string, args ...interface{}) string
+}
+
+func New(client *device.Client) *Flasher {
+	return &Flasher{
+		Client:   client,
+		Runner:   client.Runner,
+		Interval: 30 * time.Second,
+		Stderr:   os.Stderr,
+	}
+}
+
+// log returns where the output for d goes and the path of that log.
+func (f *Flasher) log(d *device.Device) (io.Writer, string) {
+	if f.DeviceLog != nil {
+		return f.DeviceLog(d)
+	}
+	return f.Stderr, f.LogPath
+}
+
+func (f *Flasher) emit(e Event) {
+	if f.Events != nil {
+		f.Events(e)
+	}
+}
+
+// wait runs a command that needs confirmation on the device, giving the operator
+// Interval to confirm, and then waits out the rest of Interval.
+func (f *Flasher) wait(ctx context.Context, run func(ctx context.Context) error) error {
+	waitCtx, cancel := context.WithTimeout(ctx, f.Interval)
+	defer cancel()
+	_ = run(waitCtx)
+	<-waitCtx.Done()
+	return ctx.Err()
+}
+
+// sleep pauses for d unless ctx is done first.
+func sleep(ctx context.Context, d time.Duration) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(d):
+		return nil
+	}
+}
+
+// Each runs fn on every device at the same time and returns the errors by serial number.
+func Each(ctx context.Context, devices []*device.Device, fn func(context.Context, *device.Device) error) map[string]error {
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	errs := map[string]error{}
+	for _, d := range devices {
+		wg.Add(1)
+		go func(d *device.Device) {
+			defer wg.Done()
+			if err := fn(ctx, d); err != nil {
+				mu.Lock()
+				errs[d.Serial] = err
+				mu.Unlock()
+			}
+		}(d)
+	}
+	wg.Wait()
+	return errs
+}
+
+// Limit returns fn letting at most n devices through at the same time, the
+// others waiting their turn, or fn itself if n is less than 1.
+func Limit(n int, fn func(context.Context, *device.Device) error) func(context.Context, *device.Device) error {
+	if n < 1 {
+		return fn
+	}
+	slots := make(chan struct{}, n)
+	return func(ctx context.Context, d *device.Device) error {
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		defer func() { <-slots }()
+		return fn(ctx, d)
+	}
+}
+
+// Flash runs the whole sequence: check the image against the device -> unlock bootloader ->
+// execute flash-all script -> relock bootloader, with the Hooks around each phase.
+func (f *Flasher) Flash(ctx context.Context, d *device.Device) (err error) {
+	if _, ok := f.Images[d.Codename]; !ok {
+		return errorf(nil, "no factory image for %s", d)
+	}
+	defer func() {
+		if err != nil {
+			// The sequence may have failed because ctx ended, which should not stop reporting it
+			f.postHook(context.Background(), HookOnFailure, d, err)
+		}
+	}()
+	if err := f.Check(ctx, d); err != nil {
+		return err
+	}
+	if err := f.hook(ctx, HookPreUnlock, d, nil); err != nil {
+		return err
+	}
+	if err := f.Unlock(ctx, d); err != nil {
+		return err
+	}
+	f.postHook(ctx, HookPostUnlock, d, nil)
+	if err := f.hook(ctx, HookPreFlash, d, nil); err != nil {
+		return err
+	}
+	if err := f.FlashAll(ctx, d); err != nil {
+		return err
+	}
+	f.postHook(ctx, HookPostFlash, d, nil)
+	if f.SkipLock {
+		return f.Reboot(ctx, d)
+	}
+	if err := f.Lock(ctx, d); err != nil {
+		return err
+	}
+	f.postHook(ctx, HookPostLock, d, nil)
+	return f.Reboot(ctx, d)
+}
+
+// Reboot boots d out of fastboot mode into Android.
+func (f *Flasher) Reboot(ctx context.Context, d *device.Device) error {
+	f.emit(Event{Device: d, Step: StepReboot})
+	_ = f.Client.Reboot(ctx, d.Serial)
+	f.emit(Event{Device: d, Step: StepDone})
+	return nil
+}
+
+// bootloader reboots d into fastboot mode if it is running Android.
+func (f *Flasher) bootloader(ctx context.Context, d *device.Device) {
+	if d.Mode == device.ADB {
+		_ = f.Client.RebootBootloader(ctx, d.Serial)
+		d.Mode = device.Fastboot
+	}
+}
+
+// Check reboots d into fastboot mode and checks that its factory image can be
+// installed on it, as android-info.txt requires, before unlocking wipes it.
+func (f *Flasher) Check(ctx context.Context, d *device.Device) error {
+	folder, ok := f.Images[d.Codename]
+	if !ok {
+		return errorf(nil, "no factory image for %s", d)
+	}
+	f.bootloader(ctx, d)
+	info, err := f.Client.Info(ctx, d.Serial)
+	if err != nil {
+		return errorf(err, "cannot check that %s can be flashed", d)
+	}
+	err = factory.Compatible(folder, info.Vars)
+	if err != nil && info.Codename() != info.Product {
+		// Images may require the codename of devices reporting another product as their board
+		vars := map[string]string{}
+		for name, value := range info.Vars {
+			vars[name] = value
+		}
+		vars["product"] = info.Codename()
+		if factory.Compatible(folder, vars) == nil {
+			err = nil
+		}
+	}
+	if err != nil {
+		return errorf(err, "%s cannot be flashed with %s", d, filepath.Base(folder))
+	}
+	return nil
+}
+
+// Unlock reboots d into fastboot mode and waits for the operator to unlock its bootloader.
+func (f *Flasher) Unlock(ctx context.Context, d *device.Device) error {
+	profile := f.Client.Profile(d.Codename)
+	f.bootloader(ctx, d)
+	f.emit(Event{Device: d, Step: StepUnlock, Action: ActionUnlock})
+	if profile.Reconnect {
+		f.emit(Event{Device: d, Step: StepUnlock, Action: ActionReconnect, Key: profile.ReconnectKey})
+	}
+	for i := 0; ; i++ {
+		if state, _ := f.Client.LockState(ctx, d); state == device.Unlocked {
+			break
+		}
+		if err := f.wait(ctx, func(ctx context.Context) error { return f.Client.Unlock(ctx, d.Serial) }); err != nil {
+			return err
+		}
+		if i >= 5 {
+			return errorf(nil, "failed to unlock %s bootloader", d)
+		}
+	}
+	if profile.CriticalUnlock {
+		for i := 0; ; i++ {
+			if unlocked, _ := f.Client.GetCriticalUnlocked(ctx, d.Serial); unlocked == "true" {
+				break
+			}
+			f.emit(Event{Device: d, Step: StepUnlockCritical, Action: ActionUnlockCritical})
+			if err := f.wait(ctx, func(ctx context.Context) error { return f.Client.UnlockCritical(ctx, d.Serial) }); err != nil {
+				return err
+			}
+			if i >= 2 {
+				return errorf(nil, "failed to unlock (critical) %s bootloader", d)
+			}
+		}
+	}
+	return nil
+}
+
+// FlashAll runs the flash-all script of the factory image matching d.
+func (f *Flasher) FlashAll(ctx context.Context, d *device.Device) error {
+	folder, ok := f.Images[d.Codename]
+	if !ok {
+		return errorf(nil, "no factory image for %s", d)
+	}
+	f.emit(Event{Device: d, Step: StepFlash})
+	script := "flash-all.sh"
+	if runtime.GOOS == "windows" {
+		script = "flash-all.bat"
+	}
+	// The count is only used to report progress, flash-all runs without it
+	partitions, _ := factory.Partitions(folder)
+	progress := &flashWriter{total: len(partitions), written: map[string]bool{}, progress: func(partition string, current, total int) {
+		f.emit(Event{Device: d, Step: StepFlash, Partition: partition, Current: current, Total: total})
+	}}
+	stderr := io.Writer(progress)
+	if log, _ := f.log(d); log != nil {
+		stderr = io.MultiWriter(log, progress)
+	}
+	flashAll := command.Cmd{
+		Argv:   []string{"." + string(os.PathSeparator) + script},
+		Dir:    folder,
+		Env:    []string{"ANDROID_SERIAL=" + d.Serial, "DEVICE_FLASHER_VERSION=" + f.Version},
+		Stdout: progress,
+		Stderr: stderr,
+	}
+	if f.ToolsPath != "" {
+		flashAll.Env = append(flashAll.Env, pathVariable()+"="+f.ToolsPath+string(os.PathListSeparator)+os.Getenv(pathVariable()))
+	}
+	if _, err := f.Runner.Run(ctx, flashAll); err != nil {
+		return errorf(err, "failed to flash %s", d)
+	}
+	return nil
+}
+
+// $ fastboot update image-redfin-tq3a.230805.001.zip
+// Sending 'boot_a' (98304 KB)                        OKAY [  2.492s]
+// Writing 'boot_a'                                   OKAY [  0.370s]
+// Sending sparse 'super' 1/4 (254972 KB)             OKAY [  6.505s]
+// Writing 'super'                                    OKAY [  1.412s]
+var writingPartition = regexp.MustCompile(`Writing '([^']+)'`)
+
+// flashWriter follows the partitions written by flash-all. Sparse images are
+// written in several chunks, so each partition is only counted once.
+type flashWriter struct {
+	mu       sync.Mutex
+	line     []byte
+	written  map[string]bool
+	total    int
+	progress func(partition string, current, total int)
+}
+
+func (fw *flashWriter) Write(p []byte) (int, error) {
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+	fw.line = append(fw.line, p...)
+	for {
+		i := bytes.IndexAny(fw.line, "\r\n")
+		if i < 0 {
+			break
+		}
+		line := fw.line[:i]
+		fw.line = fw.line[i+1:]
+		match := writingPartition.FindSubmatch(line)
+		if match == nil || fw.written[string(match[1])] {
+			continue
+		}
+		partition := string(match[1])
+		fw.written[partition] = true
+		// Slot suffixes and partitions flashed to both slots can make flash-all
+		// write more than the factory image lists.
+		if len(fw.written) > fw.total {
+			fw.total = len(fw.written)
+		}
+		fw.progress(partition, len(fw.written), fw.total)
+	}
+	return len(p), nil
+}
+
+func pathVariable() string {
+	if runtime.GOOS == "windows" {
+		return "Path"
+	}
+	return "PATH"
+}
+
+// Lock reboots d into fastboot mode if needed and waits for the operator to lock its bootloader.
+func (f *Flasher) Lock(ctx context.Context, d *device.Device) error {
+	profile := f.Client.Profile(d.Codename)
+	f.bootloader(ctx, d)
+	f.emit(Event{Device: d, Step: StepLock, Action: ActionLock})
+	for i := 0; ; i++ {
+		if state, _ := f.Client.LockState(ctx, d); state == device.Locked {
+			break
+		}
+		if profile.UnlockAbility {
+			if ability, _ := f.Client.GetUnlockAbility(ctx, d.Serial); ability != "1" {
+				return errorf(nil, "not locking bootloader of %s: fastboot flashing get_unlock_ability returned 0. Please visit https://calyxos.org/%s for more information",
+					d, d.Codename)
+			}
+		}
+		if err := f.wait(ctx, func(ctx context.Context) error { return f.Client.Lock(ctx, d.Serial) }); err != nil {
+			return err
+		}
+		if i >= 2 {
+			if profile.UncertainLock {
+				return errorf(nil, "unable to determine if %s bootloader was locked", d)
+			}
+			return errorf(nil, "failed to lock %s bootloader", d)
+		}
+	}
+	return nil
+}
+
+// Sideload installs the OTA matching d and checks that d boots into the new build.
+// d must be running Android with USB debugging enabled.
+func (f *Flasher) Sideload(ctx context.Context, d *device.Device) error {
+	otaZip, ok := f.OTAs[d.Codename]
+	if !ok {
+		return errorf(nil, "no OTA image for %s", d)
+	}
+	buildID, err := factory.OTABuildID(otaZip)
+	if err != nil {
+		return errorf(err, "cannot read the build of %s", otaZip)
+	}
+	f.emit(Event{Device: d, Step: StepRebootSideload})
+	if err := f.Client.RebootSideload(ctx, d.Serial); err != nil {
+		return errorf(err, "failed to reboot %s into sideload mode, is USB debugging enabled?", d)
+	}
+	for i := 0; ; i++ {
+		if state, _ := f.Client.GetState(ctx, d.Serial); state == "sideload" {
+			break
+		}
+		if err := sleep(ctx, 5*time.Second); err != nil {
+			return err
+		}
+		if i >= 24 {
+			return errorf(nil, "timed out waiting for %s to enter sideload mode", d)
+		}
+	}
+	f.emit(Event{Device: d, Step: StepSideload})
+	// adb sideload often fails to read the final status when the device reboots on its
+	// own, so the build check below decides whether the update was applied.
+	sideloadErr := f.Client.Sideload(ctx, d.Serial, otaZip, func(percent int) {
+		f.emit(Event{Device: d, Step: StepSideload, Percent: percent})
+	})
+	f.emit(Event{Device: d, Step: StepWaitBoot})
+	for i := 0; ; i++ {
+		if completed, _ := f.Client.GetProp(ctx, d.Serial, "sys.boot_completed"); completed == "1" {
+			break
+		}
+		if err := sleep(ctx, 10*time.Second); err != nil {
+			return err
+		}
+		if i >= 60 {
+			return errorf(nil, "timed out waiting for %s to boot", d)
+		}
+	}
+	if deviceBuildID, _ := f.Client.GetProp(ctx, d.Serial, "ro.build.id"); deviceBuildID != buildID {
+		return errorf(sideloadErr, "failed to update %s: running %s, expected %s", d, deviceBuildID, buildID)
+	}
+	f.emit(Event{Device: d, Step: StepDone})
+	return nil
+}
@@ -0,0 +1,96 @@
+// Copyright 2020 CIS Maxwell, LLC. All rights reserved.
+// Copyright 2020 The Calyx Institute
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package flash
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+
+	"gitlab.com/calyxos/device-flasher/command"
+	"gitlab.com/calyxos/device-flasher/device"
+)
+
+// Hook is a point of the Flash sequence where external commands run.
+type Hook string
+
+const (
+	// A pre hook that fails stops the sequence for the device.
+	HookPreUnlock  Hook = "pre-unlock"
+	HookPostUnlock Hook = "post-unlock"
+	HookPreFlash   Hook = "pre-flash"
+	HookPostFlash  Hook = "post-flash"
+	HookPostLock   Hook = "post-lock"
+	// HookOnFailure runs when the sequence fails for a device, pre hooks included.
+	HookOnFailure Hook = "on-failure"
+)
+
+// Hooks lists the hooks in the order they run.
+var Hooks = []Hook{HookPreUnlock, HookPostUnlock, HookPreFlash, HookPostFlash, HookPostLock, HookOnFailure}
+
+// hook runs the commands of h for d through the shell, one after the other.
+// Like flash-all, they get the device in ANDROID_SERIAL, along with:
+//
+//	DEVICE_FLASHER_VERSION   the version of the flasher
+//	DEVICE_FLASHER_HOOK      h
+//	DEVICE_FLASHER_CODENAME  the codename of d
+//	DEVICE_FLASHER_IMAGE     the factory image folder flashed
+//	DEVICE_FLASHER_RESULT    success after a phase, failure on failure
+//	DEVICE_FLASHER_ERROR     what failed, on failure
+//	DEVICE_FLASHER_LOG       the log of the sequence
+func (f *Flasher) hook(ctx context.Context, h Hook, d *device.Device, failure error) error {
+	log, logPath := f.log(d)
+	env := []string{
+		"ANDROID_SERIAL=" + d.Serial,
+		"DEVICE_FLASHER_VERSION=" + f.Version,
+		"DEVICE_FLASHER_HOOK=" + string(h),
+		"DEVICE_FLASHER_CODENAME=" + d.Codename,
+		"DEVICE_FLASHER_IMAGE=" + f.Images[d.Codename],
+		"DEVICE_FLASHER_LOG=" + logPath,
+	}
+	switch {
+	case failure != nil:
+		env = append(env, "DEVICE_FLASHER_RESULT=failure", "DEVICE_FLASHER_ERROR="+failure.Error())
+	case h == HookPostUnlock || h == HookPostFlash || h == HookPostLock:
+		env = append(env, "DEVICE_FLASHER_RESULT=success")
+	}
+	for _, line := range f.Hooks[h] {
+		if log != nil {
+			fmt.Fprintln(log, f.sprintf("Running %s hook for %s: %s", h, d, line))
+		}
+		_, err := f.Runner.Run(ctx, command.Cmd{Argv: shell(line), Env: env, Stdout: log, Stderr: log})
+		if err != nil {
+			return errorf(err, "%s hook failed for %s", h, d)
+		}
+	}
+	return nil
+}
+
+// postHook runs a hook whose failure does not stop the sequence, only reporting it.
+func (f *Flasher) postHook(ctx context.Context, h Hook, d *device.Device, failure error) {
+	if err := f.hook(ctx, h, d, failure); err != nil {
+		if log, _ := f.log(d); log != nil {
+			fmt.Fprintln(log, Message(err, f.sprintf))
+		}
+	}
+}
+
+func shell(line string) []string {
+	if runtime.GOOS == "windows" {
+		return []string{"cmd", "/C", line}
+	}
+	return []string{"/bin/sh", "-c", line}
+}
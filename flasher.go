@@ -16,24 +16,29 @@
 package main
 
 import (
-	"archive/zip"
-	"crypto/sha256"
-	"encoding/hex"
+	"context"
 	"errors"
 	"fmt"
 	"io"
-	"io/ioutil"
-	"math"
-	"net/http"
 	"os"
-	"os/exec"
 	"path"
 	"path/filepath"
-	"runtime"
+	"sort"
+	"strconv"
 	"strings"
-	"sync"
+	"text/tabwriter"
 	"time"
-	"flag"
+
+	"gitlab.com/calyxos/device-flasher/bundle"
+	"gitlab.com/calyxos/device-flasher/device"
+	"gitlab.com/calyxos/device-flasher/factory"
+	"gitlab.com/calyxos/device-flasher/flash"
+	"gitlab.com/calyxos/device-flasher/i18n"
+	"gitlab.com/calyxos/device-flasher/internal/disk"
+	"gitlab.com/calyxos/device-flasher/internal/download"
+	"gitlab.com/calyxos/device-flasher/internal/humanize"
+	"gitlab.com/calyxos/device-flasher/platformtools"
+	"gitlab.com/calyxos/device-flasher/progress"
 )
 
 var input string
@@ -41,25 +46,16 @@ var input string
 var executable, _ = os.Executable()
 var cwd = filepath.Dir(executable)
 
-var adb *exec.Cmd
-var fastboot *exec.Cmd
-
-var platformToolsZip string
-
-var deviceFactoryFolderMap map[string]string
-
-// Set via flag
-var parallel bool
-
 // Set via LDFLAGS, check Makefile
 var version string
 
-const OS = runtime.GOOS
-const PLATFORM_TOOLS_VERSION = "33.0.3"
+// Set from the environment, or the lang flag
+var printer = i18n.NewPrinter(i18n.Locale())
 
 var (
-	Error = Red
-	Warn  = Yellow
+	Error     = Red
+	Warn      = Yellow
+	Highlight = Color("\033[1;30;43m%s\033[0m")
 )
 
 var (
@@ -75,13 +71,23 @@ func Color(color string) func(...interface{}) string {
 	}
 }
 
+// tr translates a message through the catalog of the selected language.
+func tr(format string, args ...interface{}) string {
+	return printer.Sprintf(format, args...)
+}
+
 func errorln(err interface{}, fatal bool) {
-	log, _ := os.OpenFile("error.log", os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0666)
+	if e, ok := err.(error); ok {
+		// Errors of the flash sequence carry their message untranslated
+		err = flash.Message(e, printer.Sprintf)
+	}
+	_ = os.MkdirAll(filepath.Dir(errorLog()), 0755)
+	log, _ := os.OpenFile(errorLog(), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0666)
 	_, _ = fmt.Fprintln(log, err)
 	_, _ = fmt.Fprintln(os.Stderr, Error(err))
 	log.Close()
 	if fatal {
-		fmt.Println("Press enter to exit.")
+		fmt.Println(tr("Press enter to exit."))
 		_, _ = fmt.Scanln(&input)
 		os.Exit(1)
 	}
@@ -91,487 +97,524 @@ func warnln(warning interface{}) {
 	fmt.Println(Warn(warning))
 }
 
-func init() {
-	flag.BoolVar(&parallel, "parallel", false, "Flash multiple devices at the same time.")
-	flag.Parse()
+// instruct prints a numbered instruction for the operator.
+func instruct(number string, format string, args ...interface{}) {
+	warnln(number + ". " + tr(format, args...))
 }
 
-func main() {
-	_ = os.Remove("error.log")
-	fmt.Println("Android Factory Image Flasher version " + version)
-	// Map device codenames to their corresponding extracted factory image folders
-	deviceFactoryFolderMap = getFactoryFolders()
-	if len(deviceFactoryFolderMap) < 1 {
-		errorln(errors.New("Cannot continue without a device factory image. Exiting..."), true)
-	}
-	err := getPlatformTools()
-	if err != nil {
-		errorln("Cannot continue without Android platform tools. Exiting...", false)
-		errorln(err, true)
-	}
-	platformToolCommand := *adb
-	platformToolCommand.Args = append(adb.Args, "start-server")
-	err = platformToolCommand.Run()
-	if err != nil {
-		errorln("Cannot start ADB server", false)
-		errorln(err, true)
-	}
-	warnln("1. Connect to a Wi-Fi network and ensure that no SIM cards are installed")
-	warnln("2. Enable Developer Options on device (Settings -> About Phone -> tap \"Build number\" 7 times)")
-	warnln("3. Enable OEM Unlocking (Settings -> System -> Advanced -> Developer Options)")
-	warnln("4. Disconnect the USB cable from your device")
-	warnln("4.1. Power off your device")
-	warnln("4.2. Hold volume down and connect the cable to boot it into fastboot mode.")
+func pressEnter() {
 	fmt.Println()
-	fmt.Print(Warn("Press ENTER to continue"))
+	fmt.Print(Warn(tr("Press ENTER to continue")))
 	_, _ = fmt.Scanln(&input)
 	fmt.Println()
-	// Map serial numbers to device codenames by extracting them from adb and fastboot command output
-	devices := getDevices()
-	if len(devices) == 0 {
-		errorln(errors.New("No devices to be flashed. Exiting..."), true)
-	} else if !parallel && len(devices) > 1 {
-		errorln(errors.New("More than one device detected. Exiting..."), true)
-	}
-	fmt.Println()
-	fmt.Println("Devices to be flashed: ")
-	for serialNumber, device := range devices {
-		fmt.Println(device + " " + serialNumber)
-	}
-	fmt.Println()
-	fmt.Print(Warn("Press ENTER to continue"))
-	_, _ = fmt.Scanln(&input)
-	// Sequence: unlock bootloader -> execute flash-all script -> relock bootloader
-	flashDevices(devices)
 }
 
-func getFactoryFolders() map[string]string {
-	files, err := ioutil.ReadDir(cwd)
-	if err != nil {
+func main() {
+	openBundle()
+	var o options
+	command, args := parseCommand(&o, os.Args[1:])
+	if err := o.configure(command.flags); err != nil {
 		errorln(err, true)
 	}
-	deviceFactoryFolderMap := map[string]string{}
-	for _, file := range files {
-		file := file.Name()
-		if strings.Contains(file, "factory") && strings.HasSuffix(file, ".zip") {
-			extracted, err := extractZip(path.Base(file), cwd)
-			if err != nil {
-				errorln("Cannot continue without a factory image. Exiting...", false)
-				errorln(err, true)
-			}
-			device := strings.Split(file, "-")[0]
-			if _, exists := deviceFactoryFolderMap[device]; !exists {
-				deviceFactoryFolderMap[device] = extracted[0]
-			} else {
-				errorln("More than one factory image available for "+device, true)
-			}
+	_ = os.Remove(errorLog())
+	if o.lang != "" {
+		printer = i18n.NewPrinter(o.lang)
+	}
+	if !o.json {
+		fmt.Println(tr("Android Factory Image Flasher version %s", version))
+		if offline != nil {
+			fmt.Println(tr("Running offline from a bundle made on %s", offline.Created.Local().Format("2006-01-02")))
 		}
 	}
-	return deviceFactoryFolderMap
+	command.run(&o, args)
 }
 
-func getPlatformTools() error {
-	plaformToolsUrlMap := map[[2]string]string{
-		[2]string{"darwin", "33.0.3"}:  "https://dl.google.com/android/repository/platform-tools_r33.0.3-darwin.zip",
-		[2]string{"linux", "33.0.3"}:   "https://dl.google.com/android/repository/platform-tools_r33.0.3-linux.zip",
-		[2]string{"windows", "33.0.3"}: "https://dl.google.com/android/repository/platform-tools_r33.0.3-windows.zip",
+func flashCommand(o *options, args []string) {
+	// Map device codenames to their corresponding extracted factory image folders
+	zips, err := findImages(o)
+	if err == nil {
+		err = checkBundle(o, zips)
 	}
-	platformToolsChecksumMap := map[[2]string]string{
-		[2]string{"darwin", "33.0.3"}:  "84acbbd2b2ccef159ae3e6f83137e44ad18388ff3cc66bb057c87d761744e595",
-		[2]string{"linux", "33.0.3"}:   "ab885c20f1a9cb528eb145b9208f53540efa3d26258ac3ce4363570a0846f8f7",
-		[2]string{"windows", "33.0.3"}: "1e59afd40a74c5c0eab0a9fad3f0faf8a674267106e0b19921be9f67081808c2",
+	var images map[string]string
+	if err == nil {
+		images, err = factory.Extract(zips, o.cache(), printProgress(os.Stdout))
 	}
-	platformToolsOsVersion := [2]string{OS, PLATFORM_TOOLS_VERSION}
-	_, err := os.Stat(path.Base(plaformToolsUrlMap[platformToolsOsVersion]))
 	if err != nil {
-		err = downloadFile(plaformToolsUrlMap[platformToolsOsVersion])
-		if err != nil {
-			return err
-		}
+		errorln(tr("Cannot continue without a factory image. Exiting..."), false)
+		errorln(err, true)
+	}
+	if len(images) < 1 {
+		errorln(errors.New(tr("Cannot continue without a device factory image. Exiting...")), true)
+	}
+	flasher := startPlatformTools(o, os.Stdout)
+	flasher.Images = images
+	flasher.Hooks = o.hooks
+	flasher.LogPath = errorLog()
+	inv := openInventory(o, zips)
+	if o.web != "" {
+		serveStation(o, o.web, flasher, inv)
+		return
+	}
+	instruct("1", "Connect to a Wi-Fi network and ensure that no SIM cards are installed")
+	instruct("2", "Enable Developer Options on device (Settings -> About Phone -> tap \"Build number\" 7 times)")
+	instruct("3", "Enable OEM Unlocking (Settings -> System -> Advanced -> Developer Options)")
+	instruct("4", "Disconnect the USB cable from your device")
+	instruct("4.1", "Power off your device")
+	instruct("4.2", "Hold volume down and connect the cable to boot it into fastboot mode.")
+	pressEnter()
+	devices := selectDevices(flasher.Client, images, o,
+		tr("No devices to be flashed. Exiting..."), tr("Devices to be flashed:"))
+	// Sequence: unlock bootloader -> execute flash-all script -> relock bootloader
+	errs := each(o, flasher, devices, recordFlash(inv, flasher))
+	fmt.Println()
+	cleanUp(o, len(errs) == 0)
+	reportErrors(errs, tr("Failed to flash %d device(s)", len(errs)))
+	fmt.Println(Blue(tr("Flashing complete")))
+}
+
+func serveCommand(o *options, args []string) {
+	zips, err := findImages(o)
+	if err == nil {
+		err = checkBundle(o, zips)
+	}
+	var images map[string]string
+	if err == nil {
+		images, err = factory.Extract(zips, o.cache(), printProgress(os.Stdout))
 	}
-	platformToolsZip = path.Base(plaformToolsUrlMap[platformToolsOsVersion])
-	err = verifyZip(platformToolsZip, platformToolsChecksumMap[platformToolsOsVersion])
 	if err != nil {
-		fmt.Println(platformToolsZip + " checksum verification failed")
-		return err
+		errorln(err, true)
 	}
-	platformToolsPath := cwd + string(os.PathSeparator) + "platform-tools" + string(os.PathSeparator)
-	pathEnvironmentVariable := func() string {
-		if OS == "windows" {
-			return "Path"
-		} else {
-			return "PATH"
-		}
-	}()
-	_ = os.Setenv(pathEnvironmentVariable, platformToolsPath+string(os.PathListSeparator)+os.Getenv(pathEnvironmentVariable))
-	adbPath := platformToolsPath + "adb"
-	fastbootPath := platformToolsPath + "fastboot"
-	if OS == "windows" {
-		adbPath += ".exe"
-		fastbootPath += ".exe"
-	}
-	adb = exec.Command(adbPath)
-	fastboot = exec.Command(fastbootPath)
-	// Ensure that no platform tools are running before attempting to overwrite them
-	killPlatformTools()
-	_, err = extractZip(platformToolsZip, cwd)
-	return err
+	if len(images) < 1 {
+		warnln(tr("No factory images found in %s", strings.Join(o.imagesDirs, ", ")))
+	}
+	flasher := startPlatformTools(o, os.Stdout)
+	flasher.Images = images
+	flasher.Hooks = o.hooks
+	serveStation(o, o.listen, flasher, openInventory(o, zips))
 }
 
-func getDevices() map[string]string {
-	devices := map[string]string{}
-	for _, platformToolCommand := range []exec.Cmd{*adb, *fastboot} {
-		platformToolCommand.Args = append(platformToolCommand.Args, "devices")
-		output, _ := platformToolCommand.Output()
-		lines := strings.Split(string(output), "\n")
-		if platformToolCommand.Path == adb.Path {
-			lines = lines[1:]
-		}
-		for i, device := range lines {
-			if lines[i] != "" && lines[i] != "\r" {
-				serialNumber := strings.Split(device, "\t")[0]
-				if platformToolCommand.Path == adb.Path {
-					device = getProp("ro.product.device", serialNumber)
-				} else if platformToolCommand.Path == fastboot.Path {
-					device = getVar("product", serialNumber)
-					if device == "sdm845" {
-						device = "axolotl"
-					}
-				}
-				fmt.Print("Detected " + device + " " + serialNumber)
-				if _, ok := deviceFactoryFolderMap[device]; ok {
-					devices[serialNumber] = device
-					fmt.Println()
-				} else {
-					fmt.Println(". " + "No matching factory image found")
+// findImages picks the factory image of each device: the newest one, the one
+// of the build flag, or the one the operator chooses with the choose flag.
+func findImages(o *options) (map[string]string, error) {
+	candidates, err := factory.Scan(o.imagesDirs, o.recursive)
+	if err != nil {
+		return nil, err
+	}
+	var codenames []string
+	for codename := range candidates {
+		codenames = append(codenames, codename)
+	}
+	sort.Strings(codenames)
+	images := map[string]string{}
+	for _, codename := range codenames {
+		found := candidates[codename]
+		switch {
+		case o.build != "":
+			for _, image := range found {
+				if strings.EqualFold(image.BuildID, o.build) {
+					images[codename] = image.Path
+					break
 				}
 			}
+			if _, ok := images[codename]; !ok {
+				warnln(tr("No factory image of build %s for %s", o.build, codename))
+			}
+		case o.choose && len(found) > 1:
+			images[codename] = chooseImage(codename, found).Path
+		default:
+			images[codename] = found[0].Path
 		}
 	}
-	return devices
+	return images, nil
 }
 
-// $ fastboot getvar prop
-// prop: value
-// Finished. Total time: 0.002s
-func getVar(prop string, device string) string {
-	platformToolCommand := *fastboot
-	platformToolCommand.Args = append(fastboot.Args, "-s", device, "getvar", prop)
-	out, err := platformToolCommand.CombinedOutput()
-	if err != nil {
-		return ""
-	}
-	lines := strings.Split(string(out), "\n")
-	for _, line := range lines {
-		if strings.Contains(line, prop) {
-			return strings.Trim(strings.Split(line, " ")[1], "\r")
+// chooseImage asks the operator which of the factory images found for
+// codename to use, the newest one by default.
+func chooseImage(codename string, found []factory.ImageInfo) factory.ImageInfo {
+	fmt.Println()
+	fmt.Println(tr("Several factory images are available for %s:", codename))
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for i, image := range found {
+		fmt.Fprintf(w, "  %d.\t%s\t%s\t%s\t%s\n", i+1, orNone(image.BuildID), image.Date.Format("2006-01-02"),
+			orNone(image.Channel), filepath.Base(image.Path))
+	}
+	w.Flush()
+	for {
+		fmt.Print(Warn(tr("Choose an image (1-%d), or press ENTER for the newest: ", len(found))))
+		input = ""
+		if _, err := fmt.Scanln(&input); err != nil && input == "" {
+			fmt.Println()
+			return found[0]
 		}
-	}
-	return ""
-}
-
-// $ fastboot flashing get_unlock_ability
-// (bootloader) get_unlock_ability: 0
-// OKAY [  0.000s]
-// Finished. Total time: 0.000s
-func getUnlockAbility(device string) string {
-	platformToolCommand := *fastboot
-	platformToolCommand.Args = append(fastboot.Args, "-s", device, "flashing", "get_unlock_ability")
-	out, err := platformToolCommand.CombinedOutput()
-	if err != nil {
-		return ""
-	}
-	lines := strings.Split(string(out), "\n")
-	for _, line := range lines {
-		if strings.Contains(line, "get_unlock_ability") {
-			return strings.Trim(strings.Split(line, " ")[2], "\r")
+		if n, err := strconv.Atoi(input); err == nil && n >= 1 && n <= len(found) {
+			fmt.Println()
+			return found[n-1]
 		}
 	}
-	return ""
 }
 
-// Moto:
-// $ fastboot getvar securestate
-// securestate: flashing_locked
-// Finished. Total time: 0.001s
-// Rest:
-// $ fastboot getvar unlocked
-// unlocked: no
-// Finished. Total time: 0.009s
+func unlockCommand(o *options, args []string) {
+	flasher := startPlatformTools(o, os.Stdout)
+	instruct("1", "Enable OEM Unlocking (Settings -> System -> Advanced -> Developer Options)")
+	instruct("2", "Connect the device with USB debugging enabled, or in fastboot mode")
+	pressEnter()
+	devices := selectDevices(flasher.Client, nil, o,
+		tr("No devices to be unlocked. Exiting..."), tr("Devices to be unlocked:"))
+	errs := each(o, flasher, devices, flasher.Unlock)
+	fmt.Println()
+	reportErrors(errs, tr("Failed to unlock %d device(s)", len(errs)))
+	fmt.Println(Blue(tr("Unlocking complete")))
+}
 
-func isNotLocked(serialNumber string, device string) bool {
-	if device == "devon" || device == "hawao" || device == "rhode" || device == "bangkk" || device == "fogo" || device == "fogos" {
-		return getVar("securestate", serialNumber) != "flashing_locked"
-	}
-	return getVar("unlocked", serialNumber) != "no"
+func lockCommand(o *options, args []string) {
+	flasher := startPlatformTools(o, os.Stdout)
+	instruct("1", "Connect the device with USB debugging enabled, or in fastboot mode")
+	pressEnter()
+	devices := selectDevices(flasher.Client, nil, o,
+		tr("No devices to be locked. Exiting..."), tr("Devices to be locked:"))
+	errs := each(o, flasher, devices, func(ctx context.Context, d *device.Device) error {
+		if err := flasher.Lock(ctx, d); err != nil {
+			return err
+		}
+		return flasher.Reboot(ctx, d)
+	})
+	fmt.Println()
+	reportErrors(errs, tr("Failed to lock %d device(s)", len(errs)))
+	fmt.Println(Blue(tr("Locking complete")))
 }
 
-func isNotUnlocked(serialNumber string, device string) bool {
-	if device == "devon" || device == "hawao" || device == "rhode" || device == "bangkk" || device == "fogo" || device == "fogos" {
-		return getVar("securestate", serialNumber) != "flashing_unlocked"
+func otaCommand(o *options, zips []string) {
+	// Map device codenames to their corresponding OTA zips
+	otas, err := factory.DiscoverOTA(o.imagesDirs, o.recursive, zips)
+	if err != nil {
+		errorln(err, true)
 	}
-	return getVar("unlocked", serialNumber) != "yes"
+	if len(otas) < 1 {
+		errorln(errors.New(tr("Cannot continue without a device OTA image. Exiting...")), true)
+	}
+	flasher := startPlatformTools(o, os.Stdout)
+	flasher.OTAs = otas
+	instruct("1", "Enable Developer Options on device (Settings -> About Phone -> tap \"Build number\" 7 times)")
+	instruct("2", "Enable USB debugging (Settings -> System -> Advanced -> Developer Options)")
+	instruct("3", "Connect the cable and allow USB debugging on the device when asked")
+	pressEnter()
+	devices := selectDevices(flasher.Client, otas, o,
+		tr("No devices to be updated. Exiting..."), tr("Devices to be updated:"))
+	// Sequence: reboot to sideload -> adb sideload -> wait for reboot -> check build
+	errs := each(o, flasher, devices, flasher.Sideload)
+	fmt.Println()
+	reportErrors(errs, tr("Failed to update %d device(s)", len(errs)))
+	fmt.Println(Blue(tr("Sideloading complete")))
 }
 
-// $ fastboot oem device-info
-// (bootloader) Verity mode: false
-// (bootloader) Device unlocked: true
-// (bootloader) Device critical unlocked: true
-// (bootloader) Charger screen enabled: false
-// OKAY [  0.000s]
-// Finished. Total time: 0.000s
-func getCriticalUnlocked(device string) string {
-	platformToolCommand := *fastboot
-	platformToolCommand.Args = append(fastboot.Args, "-s", device, "oem", "device-info")
-	out, err := platformToolCommand.CombinedOutput()
+func devicesCommand(o *options, args []string) {
+	zips, err := findImages(o)
+	if err != nil {
+		errorln(err, false)
+	}
+	otas, err := factory.DiscoverOTA(o.imagesDirs, o.recursive, nil)
 	if err != nil {
-		return ""
+		errorln(err, false)
+	}
+	out := io.Writer(os.Stdout)
+	if o.json {
+		out = os.Stderr
 	}
-	lines := strings.Split(string(out), "\n")
-	for _, line := range lines {
-		if strings.Contains(line, "Device critical unlocked:") {
-			return strings.Trim(strings.Split(line, " ")[4], "\r")
+	client := startPlatformTools(o, out).Client
+	devices, err := client.Devices(context.Background())
+	if err != nil {
+		// The devices adb or fastboot found are still listed
+		errorln(err, len(devices) == 0)
+	}
+	if o.json {
+		type match struct {
+			*device.Device
+			Factory string `json:"factory,omitempty"`
+			OTA     string `json:"ota,omitempty"`
 		}
+		matches := []match{}
+		for _, d := range devices {
+			matches = append(matches, match{d, zips[d.Codename], otas[d.Codename]})
+		}
+		printJSON(matches)
+		return
+	}
+	if len(devices) == 0 {
+		fmt.Println(tr("No devices detected"))
+		return
+	}
+	fmt.Println()
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, tr("SERIAL\tCODENAME\tMODE\tFACTORY IMAGE\tOTA"))
+	for _, d := range devices {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", d.Serial, d.Codename, d.Mode,
+			orNone(zips[d.Codename]), orNone(otas[d.Codename]))
 	}
-	return ""
+	w.Flush()
 }
 
-func getProp(prop string, device string) string {
-	platformToolCommand := *adb
-	platformToolCommand.Args = append(adb.Args, "-s", device, "shell", "getprop", prop)
-	out, err := platformToolCommand.Output()
-	if err != nil {
-		return ""
+func orNone(file string) string {
+	if file == "" {
+		return "-"
 	}
-	return strings.Trim(string(out), "[]\n\r")
+	return filepath.Base(file)
 }
 
-func flashDevices(devices map[string]string) {
-	var wg sync.WaitGroup
-	for serialNumber, device := range devices {
-		wg.Add(1)
-		go func(serialNumber, device string) {
-			defer wg.Done()
-			platformToolCommand := *adb
-			platformToolCommand.Args = append(platformToolCommand.Args, "-s", serialNumber, "reboot", "bootloader")
-			_ = platformToolCommand.Run()
-			fmt.Println("Unlocking " + device + " " + serialNumber + " bootloader...")
-			warnln("5. Please use the volume and power keys on the device to unlock the bootloader")
-			if device == "FP4" || device == "FP5" || device == "axolotl" || device == "otter" {
-				fmt.Println()
-				warnln("  5a. Once " + device + " " + serialNumber + " boots, disconnect its cable and power it off")
-				if device == "axolotl" || device == "otter" {
-					warnln("  5b. Then, hold volume up and connect the cable again to boot it into fastboot mode.")
-				} else {
-					warnln("  5b. Then, hold volume down and connect the cable again to boot it into fastboot mode.")
-				}
-				fmt.Println("The installation will resume automatically")
+func verifyCommand(o *options, args []string) {
+	candidates, err := factory.Scan(o.imagesDirs, o.recursive)
+	if err != nil {
+		errorln(err, false)
+	}
+	otas, err := factory.DiscoverOTA(o.imagesDirs, o.recursive, nil)
+	if err != nil {
+		errorln(err, false)
+	}
+	var files []string
+	factories := map[string]bool{}
+	for _, found := range candidates {
+		for _, image := range found {
+			files = append(files, image.Path)
+			factories[image.Path] = true
+		}
+	}
+	for _, ota := range otas {
+		files = append(files, ota)
+	}
+	failed := 0
+	for _, file := range files {
+		fmt.Println(tr("Verifying %s", filepath.Base(file)))
+		if factories[file] {
+			// Report everything wrong with the layout, not just the first problem
+			report, err := factory.Validate(file)
+			if err != nil {
+				errorln(filepath.Base(file)+": "+err.Error(), false)
+				failed++
+				continue
 			}
-			for i := 0; isNotUnlocked(serialNumber, device); i++ {
-				platformToolCommand = *fastboot
-				platformToolCommand.Args = append(platformToolCommand.Args, "-s", serialNumber, "flashing", "unlock")
-				_ = platformToolCommand.Start()
-				time.Sleep(30 * time.Second)
-				if i >= 5 {
-					errorln("Failed to unlock "+device+" "+serialNumber+" bootloader", true)
-					return
-				}
+			for _, warning := range report.Warnings {
+				warnln("  " + warning)
 			}
-			if device == "FP4" || device == "FP5" || device == "otter" {
-				for i := 0; getCriticalUnlocked(serialNumber) != "true"; i++ {
-					fmt.Println("Unlocking (critical) " + device + " " + serialNumber + " bootloader...")
-					warnln("5.1. Please use the volume and power keys on the device to unlock the bootloader (critical)")
-					fmt.Println()
-					platformToolCommand = *fastboot
-					platformToolCommand.Args = append(platformToolCommand.Args, "-s", serialNumber, "flashing", "unlock_critical")
-					_ = platformToolCommand.Start()
-					time.Sleep(30 * time.Second)
-					if i >= 2 {
-						errorln("Failed to unlock (critical) "+device+" "+serialNumber+" bootloader", true)
-						return
-					}
-				}
+			for _, problem := range report.Problems {
+				errorln("  "+problem, false)
 			}
-			fmt.Println("Flashing " + device + " " + serialNumber + " bootloader...")
-			flashAll := exec.Command("." + string(os.PathSeparator) + "flash-all" + func() string {
-				if OS == "windows" {
-					return ".bat"
-				} else {
-					return ".sh"
-				}
-			}())
-			flashAll.Dir = deviceFactoryFolderMap[device]
-			flashAll.Stderr = os.Stderr
-			flashAll.Env = append(flashAll.Environ(), "ANDROID_SERIAL="+serialNumber)
-			flashAll.Env = append(flashAll.Environ(), "DEVICE_FLASHER_VERSION="+version)
-			err := flashAll.Run()
-			if err != nil {
-				errorln("Failed to flash "+device+" "+serialNumber, false)
-				errorln(err.Error(), false)
-				return
+			if len(report.Problems) > 0 {
+				failed++
+				continue
 			}
-			fmt.Println("Locking " + device + " " + serialNumber + " bootloader...")
-			warnln("6. Please use the volume and power keys on the device to lock the bootloader")
-			for i := 0; isNotLocked(serialNumber, device); i++ {
-				if (device == "FP4" || device == "FP5") && getUnlockAbility(serialNumber) != "1" {
-					errorln("Not locking bootloader of "+device+" "+serialNumber, false)
-					errorln("fastboot flashing get_unlock_ability returned 0", false)
-					errorln("Please visit https://calyxos.org/FP4 for more information.", true)
-					return
-				}
-				platformToolCommand = *fastboot
-				platformToolCommand.Args = append(platformToolCommand.Args, "-s", serialNumber, "flashing", "lock")
-				_ = platformToolCommand.Start()
-				time.Sleep(30 * time.Second)
-				if i >= 2 {
-					if device == "FP4" || device == "FP5" || device == "axolotl" || device == "otter" {
-						errorln("Unable to determine if bootloader was locked", true)
-						return
-					}
-					errorln("Failed to lock "+device+" "+serialNumber+" bootloader", false)
-					return
-				}
+		}
+		if err := factory.Verify(file); err != nil {
+			errorln(filepath.Base(file)+": "+err.Error(), false)
+			failed++
+		}
+	}
+	platformTools := o.platformTools(os.Stdout)
+	if platformToolsZip, err := platformTools.Zip(); err == nil {
+		if _, err := os.Stat(platformToolsZip); err == nil {
+			if err := platformTools.Verify(); err != nil {
+				errorln(err, false)
+				failed++
 			}
-			fmt.Println("Rebooting " + device + " " + serialNumber + "...")
-			platformToolCommand = *fastboot
-			platformToolCommand.Args = append(platformToolCommand.Args, "-s", serialNumber, "reboot")
-			_ = platformToolCommand.Start()
-		}(serialNumber, device)
+		}
+	}
+	if offline != nil {
+		if err := offline.Verify(cwd, printProgress(os.Stdout)); err != nil {
+			errorln(err, false)
+			failed++
+		}
 	}
-	wg.Wait()
 	fmt.Println()
-	fmt.Println(Blue("Flashing complete"))
+	if failed > 0 {
+		errorln(tr("%d file(s) failed verification", failed), true)
+	}
+	fmt.Println(Blue(tr("Verification complete")))
 }
 
-func killPlatformTools() {
-	_, err := os.Stat(adb.Path)
-	if err == nil {
-		platformToolCommand := *adb
-		platformToolCommand.Args = append(platformToolCommand.Args, "kill-server")
-		_ = platformToolCommand.Run()
+func downloadCommand(o *options, urls []string) {
+	if offline != nil {
+		errorln(errors.New(tr("The flasher runs from an offline bundle and does not download anything")), true)
 	}
-	if OS == "windows" {
-		_ = exec.Command("taskkill", "/IM", "fastboot.exe", "/F").Run()
+	ctx := context.Background()
+	err := o.platformTools(os.Stdout).Download(ctx)
+	if err != nil {
+		errorln(err, true)
+	}
+	// Fail before downloading anything if the images will not all fit. Sizes
+	// the servers do not tell are left to the check of each download.
+	var needed uint64
+	for _, url := range urls {
+		size, _ := download.Size(ctx, url)
+		needed += size
+	}
+	if err := disk.Check(o.imagesDirs[0], needed); err != nil {
+		errorln(err, true)
 	}
+	for _, url := range urls {
+		file := filepath.Join(o.imagesDirs[0], path.Base(url))
+		if err := download.Retry(ctx, o.settings.Retries, url, file, printProgress(os.Stdout)); err != nil {
+			errorln(err, true)
+		}
+		fmt.Println(tr("Verifying %s", filepath.Base(file)))
+		if err := factory.Verify(file); err != nil {
+			errorln(filepath.Base(file)+": "+err.Error(), true)
+		}
+	}
+	fmt.Println(Blue(tr("Download complete")))
+}
+
+// platformTools returns the platform tools downloaded into the work folder as configured.
+func (o *options) platformTools(out io.Writer) *platformtools.PlatformTools {
+	platformTools := platformtools.New(downloadsDir(), printProgress(out))
+	platformTools.Mirror = o.settings.PlatformToolsMirror
+	platformTools.Retries = o.settings.Retries
+	platformTools.Cache = o.cache()
+	if offline != nil {
+		platformTools.ZipDir = bundle.Folder(cwd, bundle.PlatformTools)
+		platformTools.Offline = true
+	}
+	return platformTools
 }
 
-func downloadFile(url string) error {
-	fmt.Println("Downloading " + url)
-	resp, err := http.Get(url)
+func startPlatformTools(o *options, out io.Writer) *flash.Flasher {
+	platformTools := o.platformTools(out)
+	err := platformTools.Get(context.Background())
 	if err != nil {
-		return err
+		errorln(tr("Cannot continue without Android platform tools. Exiting..."), false)
+		errorln(err, true)
 	}
-	defer resp.Body.Close()
-
-	out, err := os.Create(path.Base(url))
+	client := device.NewClient(platformTools.ADB(), platformTools.Fastboot())
+	client.Profiles = o.settings.Profiles
+	err = client.StartServer(context.Background())
 	if err != nil {
-		return err
+		errorln(tr("Cannot start ADB server"), false)
+		errorln(err, true)
 	}
-	defer out.Close()
-
-	counter := &WriteCounter{}
-	_, err = io.Copy(out, io.TeeReader(resp.Body, counter))
-	fmt.Println()
-	return err
+	flasher := flash.New(client)
+	flasher.ToolsPath = platformTools.Path()
+	flasher.Version = version
+	flasher.Interval = time.Duration(o.settings.Timeouts.Prompt) * time.Second
+	flasher.Events = printEvent
+	flasher.Sprintf = printer.Sprintf
+	return flasher
 }
 
-func extractZip(src string, destination string) ([]string, error) {
-	fmt.Println("Extracting " + src)
-	var filenames []string
-	r, err := zip.OpenReader(src)
+// selectDevices detects the devices matching images (any device with a known
+// codename if images is nil) and the serial flag, and asks to go ahead.
+func selectDevices(client *device.Client, images map[string]string, o *options, none, selected string) []*device.Device {
+	// Map serial numbers to device codenames by extracting them from adb and fastboot command output
+	detected, err := client.Devices(context.Background())
 	if err != nil {
-		return filenames, err
+		errorln(err, false)
 	}
-	defer r.Close()
-
-	for _, f := range r.File {
-		fpath := filepath.Join(destination, f.Name)
-		if !strings.HasPrefix(fpath, filepath.Clean(destination)+string(os.PathSeparator)) {
-			return filenames, fmt.Errorf("%s is an illegal filepath", fpath)
-		}
-		filenames = append(filenames, fpath)
-		if f.FileInfo().IsDir() {
-			os.MkdirAll(fpath, os.ModePerm)
+	var devices []*device.Device
+	for _, d := range detected {
+		if o.serial != "" && d.Serial != o.serial {
 			continue
 		}
-		if err = os.MkdirAll(filepath.Dir(fpath), os.ModePerm); err != nil {
-			return filenames, err
-		}
-		outFile, err := os.OpenFile(fpath,
-			os.O_WRONLY|os.O_CREATE|os.O_TRUNC,
-			f.Mode())
-		if err != nil {
-			return filenames, err
-		}
-		rc, err := f.Open()
-		if err != nil {
-			return filenames, err
-		}
-		_, err = io.Copy(outFile, rc)
-		outFile.Close()
-		rc.Close()
-		if err != nil {
-			return filenames, err
+		fmt.Print(tr("Detected %s", d))
+		if _, ok := images[d.Codename]; ok || (images == nil && d.Codename != "") {
+			devices = append(devices, d)
+			fmt.Println()
+		} else {
+			fmt.Println(". " + tr("No matching image found"))
 		}
 	}
-	return filenames, nil
-}
-
-func verifyZip(zipfile, sha256sum string) error {
-	fmt.Println("Verifying " + zipfile)
-	f, err := os.Open(zipfile)
-	if err != nil {
-		return err
-	}
-	defer f.Close()
-
-	h := sha256.New()
-	if _, err := io.Copy(h, f); err != nil {
-		return err
+	if len(devices) == 0 {
+		errorln(errors.New(none), true)
+	} else if !o.parallel && len(devices) > 1 {
+		errorln(errors.New(tr("More than one device detected. Exiting...")), true)
 	}
-	sum := hex.EncodeToString(h.Sum(nil))
-	if sha256sum == sum {
-		return nil
+	fmt.Println()
+	fmt.Println(selected)
+	for _, d := range devices {
+		fmt.Println(d)
 	}
-	return errors.New("sha256sum mismatch")
-}
-
-type WriteCounter struct {
-	Total uint64
-}
-
-func (wc *WriteCounter) Write(p []byte) (int, error) {
-	n := len(p)
-	wc.Total += uint64(n)
-	wc.PrintProgress()
-	return n, nil
+	pressEnter()
+	return devices
 }
 
-func (wc WriteCounter) PrintProgress() {
-	fmt.Printf("\r%s", strings.Repeat(" ", 35))
-	fmt.Printf("\rDownloading... %s downloaded", Bytes(wc.Total))
+func reportErrors(errs map[string]error, message string) {
+	if len(errs) == 0 {
+		return
+	}
+	for _, err := range errs {
+		errorln(err, false)
+	}
+	errorln(message, true)
 }
 
-func logn(n, b float64) float64 {
-	return math.Log(n) / math.Log(b)
+func printEvent(e flash.Event) {
+	d := e.Device.String()
+	switch {
+	case e.Action == flash.ActionUnlock:
+		fmt.Println(tr("Unlocking %s bootloader...", d))
+		instruct("5", "Please use the volume and power keys on the device to unlock the bootloader")
+	case e.Action == flash.ActionReconnect:
+		fmt.Println()
+		instruct("  5a", "Once %s boots, disconnect its cable and power it off", d)
+		instruct("  5b", "Then, hold %s and connect the cable again to boot it into fastboot mode.",
+			keyName(e.Key))
+		fmt.Println(tr("The installation will resume automatically"))
+	case e.Action == flash.ActionUnlockCritical:
+		fmt.Println(tr("Unlocking (critical) %s bootloader...", d))
+		instruct("5.1", "Please use the volume and power keys on the device to unlock the bootloader (critical)")
+		fmt.Println()
+	case e.Step == flash.StepFlash && e.Partition == "":
+		fmt.Println(tr("Flashing %s bootloader...", d))
+	case e.Action == flash.ActionLock:
+		fmt.Println(tr("Locking %s bootloader...", d))
+		instruct("6", "Please use the volume and power keys on the device to lock the bootloader")
+	case e.Step == flash.StepReboot:
+		fmt.Println(tr("Rebooting %s...", d))
+	case e.Step == flash.StepRebootSideload:
+		fmt.Println(tr("Rebooting %s into sideload mode...", d))
+	case e.Step == flash.StepSideload && e.Percent == 0:
+		fmt.Println(tr("Sideloading to %s...", d))
+	case e.Step == flash.StepSideload:
+		fmt.Printf("\r%s", strings.Repeat(" ", 35))
+		fmt.Print("\r" + tr("Sideloading %s... %d%%", d, e.Percent))
+	case e.Step == flash.StepWaitBoot:
+		fmt.Println()
+		fmt.Println(tr("Waiting for %s to reboot...", d))
+	}
 }
 
-func humanateBytes(s uint64, base float64, sizes []string) string {
-	if s < 10 {
-		return fmt.Sprintf("%d B", s)
+func keyName(key string) string {
+	switch key {
+	case "volume up":
+		return tr("volume up")
+	case "volume down":
+		return tr("volume down")
 	}
-	e := math.Floor(logn(float64(s), base))
-	suffix := sizes[int(e)]
-	val := math.Floor(float64(s)/math.Pow(base, e)*10+0.5) / 10
-	f := "%.0f %s"
-	if val < 10 {
-		f = "%.1f %s"
-	}
-
-	return fmt.Sprintf(f, val, suffix)
+	return key
 }
 
-func Bytes(s uint64) string {
-	sizes := []string{"B", "kB", "MB", "GB", "TB", "PB", "EB"}
-	return humanateBytes(s, 1000, sizes)
+// printProgress returns a progress.Func printing to out.
+func printProgress(out io.Writer) progress.Func {
+	return func(e progress.Event) {
+		switch {
+		case e.Op == progress.Download && e.Done:
+			fmt.Fprintln(out)
+		case e.Op == progress.Download && e.Current == 0:
+			fmt.Fprintln(out, tr("Downloading %s", e.File))
+		case e.Op == progress.Download:
+			fmt.Fprintf(out, "\r%s", strings.Repeat(" ", 35))
+			fmt.Fprint(out, "\r"+tr("Downloading... %s downloaded", humanize.Bytes(e.Current)))
+		case e.Op == progress.Verify && !e.Done:
+			fmt.Fprintln(out, tr("Verifying %s", filepath.Base(e.File)))
+		case e.Op == progress.Extract && e.Done:
+			fmt.Fprintln(out)
+		case e.Op == progress.Extract && e.Current == 0:
+			fmt.Fprintln(out, tr("Extracting %s", filepath.Base(e.File)))
+		case e.Op == progress.Extract:
+			fmt.Fprintf(out, "\r%s", strings.Repeat(" ", 35))
+			fmt.Fprint(out, "\r"+tr("Extracting... %s of %s", humanize.Bytes(e.Current), humanize.Bytes(e.Total)))
+		case e.Op == progress.Archive && e.Done:
+			fmt.Fprintln(out)
+		case e.Op == progress.Archive && e.Current == 0:
+			fmt.Fprintln(out, tr("Adding %s", filepath.Base(e.File)))
+		case e.Op == progress.Archive:
+			fmt.Fprintf(out, "\r%s", strings.Repeat(" ", 35))
+			fmt.Fprint(out, "\r"+tr("Adding... %s of %s", humanize.Bytes(e.Current), humanize.Bytes(e.Total)))
+		}
+	}
 }
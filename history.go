@@ -0,0 +1,138 @@
+// Copyright 2020 CIS Maxwell, LLC. All rights reserved.
+// Copyright 2020 The Calyx Institute
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"text/tabwriter"
+	"time"
+
+	"gitlab.com/calyxos/device-flasher/device"
+	"gitlab.com/calyxos/device-flasher/flash"
+	"gitlab.com/calyxos/device-flasher/inventory"
+	"gitlab.com/calyxos/device-flasher/platformtools"
+)
+
+func inventoryPath() string {
+	return filepath.Join(dataHome(), "inventory.jsonl")
+}
+
+// openInventory prepares the records of flashing images, the factory zips or
+// folders by codename. Extracted folders are recorded without a SHA-256 sum.
+func openInventory(o *options, images map[string]string) *inventory.Inventory {
+	inv := inventory.New(inventoryPath())
+	inv.FlasherVersion = version
+	inv.PlatformToolsVersion = platformtools.Version
+	inv.Operator = o.operatorName()
+	for codename, image := range images {
+		var sum string
+		if info, err := os.Stat(image); err == nil && !info.IsDir() {
+			if sum, err = o.cache().SHA256(image); err != nil {
+				errorln(err, true)
+			}
+		}
+		inv.Images[codename] = inventory.Image{File: filepath.Base(image), SHA256: sum}
+	}
+	return inv
+}
+
+// operatorName returns the operator flag, or the name of the user running the flasher.
+func (o *options) operatorName() string {
+	if o.operator != "" {
+		return o.operator
+	}
+	if u, err := user.Current(); err == nil {
+		return u.Username
+	}
+	return ""
+}
+
+// recordFlash returns a function flashing a device with flasher and recording
+// how it went in inv.
+func recordFlash(inv *inventory.Inventory, flasher *flash.Flasher) func(context.Context, *device.Device) error {
+	return func(ctx context.Context, d *device.Device) error {
+		f := *flasher
+		entry := inv.Begin(&f, d)
+		err := f.Flash(ctx, d)
+		if recordErr := entry.End(err); recordErr != nil {
+			if err != nil {
+				return fmt.Errorf("%w (not recorded in the inventory: %v)", err, recordErr)
+			}
+			return fmt.Errorf("%s was flashed but not recorded in the inventory: %w", d, recordErr)
+		}
+		return err
+	}
+}
+
+func historyCommand(o *options, args []string) {
+	filter := inventory.Filter{Serial: o.serial, AssetTag: o.tag, Codename: o.codename, Operator: o.operator, Result: o.result}
+	var err error
+	if filter.Since, err = parseDate(o.since, false); err != nil {
+		errorln(err, true)
+	}
+	if filter.Until, err = parseDate(o.until, true); err != nil {
+		errorln(err, true)
+	}
+	records, err := inventory.New(inventoryPath()).Records(filter)
+	if err != nil {
+		errorln(err, true)
+	}
+	switch {
+	case o.csv:
+		if err := inventory.WriteCSV(os.Stdout, records); err != nil {
+			errorln(err, true)
+		}
+	case o.json:
+		if records == nil {
+			records = []inventory.Record{}
+		}
+		printJSON(records)
+	case len(records) == 0:
+		fmt.Println(tr("No devices recorded"))
+	default:
+		fmt.Println()
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, tr("STARTED\tSERIAL\tASSET TAG\tCODENAME\tFACTORY IMAGE\tRESULT\tBOOTLOADER\tOPERATOR"))
+		for _, r := range records {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", r.Started.Local().Format("2006-01-02 15:04"),
+				r.Serial, orNone(r.AssetTag), r.Codename, orNone(r.Image), r.Result, r.LockState, r.Operator)
+		}
+		w.Flush()
+	}
+}
+
+// parseDate reads a date (2006-01-02) or a time (RFC 3339) in the local time
+// zone. A date read as the end of a range includes the whole day.
+func parseDate(value string, end bool) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	t, err := time.ParseInLocation("2006-01-02", value, time.Local)
+	if err != nil {
+		return t, fmt.Errorf("invalid date %s, expected YYYY-MM-DD", value)
+	}
+	if end {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t, nil
+}
@@ -0,0 +1,183 @@
+// Copyright 2020 CIS Maxwell, LLC. All rights reserved.
+// Copyright 2020 The Calyx Institute
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package i18n
+
+var de = Catalog{
+	"Android Factory Image Flasher version %s":                   "Android-Werksimage-Installer, Version %s",
+	"Press enter to exit.":                                       "Zum Beenden Eingabetaste drücken.",
+	"Press ENTER to continue":                                    "Zum Fortfahren EINGABETASTE drücken",
+	"Cannot continue without a factory image. Exiting...":        "Ohne Werksimage kann nicht fortgefahren werden. Beende...",
+	"Cannot continue without a device factory image. Exiting...": "Ohne Werksimage für das Gerät kann nicht fortgefahren werden. Beende...",
+	"Cannot continue without a device OTA image. Exiting...":     "Ohne OTA-Image für das Gerät kann nicht fortgefahren werden. Beende...",
+	"Cannot continue without Android platform tools. Exiting...": "Ohne die Android Platform Tools kann nicht fortgefahren werden. Beende...",
+	"Cannot start ADB server":                                    "ADB-Server kann nicht gestartet werden",
+
+	"Connect to a Wi-Fi network and ensure that no SIM cards are installed":                        "Mit einem WLAN verbinden und sicherstellen, dass keine SIM-Karte eingelegt ist",
+	"Enable Developer Options on device (Settings -> About Phone -> tap \"Build number\" 7 times)": "Entwickleroptionen auf dem Gerät aktivieren (Einstellungen -> Über das Telefon -> 7-mal auf \"Build-Nummer\" tippen)",
+	"Enable OEM Unlocking (Settings -> System -> Advanced -> Developer Options)":                   "OEM-Entsperrung aktivieren (Einstellungen -> System -> Erweitert -> Entwickleroptionen)",
+	"Disconnect the USB cable from your device":                                                    "USB-Kabel vom Gerät trennen",
+	"Power off your device": "Gerät ausschalten",
+	"Hold volume down and connect the cable to boot it into fastboot mode.":                  "Leiser-Taste gedrückt halten und das Kabel anschließen, um in den Fastboot-Modus zu starten.",
+	"Connect the device with USB debugging enabled, or in fastboot mode":                     "Gerät mit aktiviertem USB-Debugging oder im Fastboot-Modus anschließen",
+	"Enable USB debugging (Settings -> System -> Advanced -> Developer Options)":             "USB-Debugging aktivieren (Einstellungen -> System -> Erweitert -> Entwickleroptionen)",
+	"Connect the cable and allow USB debugging on the device when asked":                     "Kabel anschließen und USB-Debugging auf dem Gerät erlauben, wenn danach gefragt wird",
+	"Please use the volume and power keys on the device to unlock the bootloader":            "Bitte mit den Lautstärke- und Ein/Aus-Tasten des Geräts den Bootloader entsperren",
+	"Please use the volume and power keys on the device to unlock the bootloader (critical)": "Bitte mit den Lautstärke- und Ein/Aus-Tasten des Geräts den Bootloader entsperren (kritisch)",
+	"Please use the volume and power keys on the device to lock the bootloader":              "Bitte mit den Lautstärke- und Ein/Aus-Tasten des Geräts den Bootloader sperren",
+	"Once %s boots, disconnect its cable and power it off":                                   "Sobald %s gestartet ist, das Kabel trennen und das Gerät ausschalten",
+	"Then, hold %s and connect the cable again to boot it into fastboot mode.":               "Dann %s gedrückt halten und das Kabel wieder anschließen, um in den Fastboot-Modus zu starten.",
+	"volume up":   "die Lauter-Taste",
+	"volume down": "die Leiser-Taste",
+	"The installation will resume automatically": "Die Installation wird automatisch fortgesetzt",
+
+	"Detected %s":                               "%s erkannt",
+	"No matching image found":                   "Kein passendes Image gefunden",
+	"More than one device detected. Exiting...": "Mehr als ein Gerät erkannt. Beende...",
+	"No devices detected":                       "Keine Geräte erkannt",
+	"No devices to be flashed. Exiting...":      "Keine Geräte zum Installieren. Beende...",
+	"No devices to be unlocked. Exiting...":     "Keine Geräte zum Entsperren. Beende...",
+	"No devices to be locked. Exiting...":       "Keine Geräte zum Sperren. Beende...",
+	"No devices to be updated. Exiting...":      "Keine Geräte zum Aktualisieren. Beende...",
+	"Devices to be flashed:":                    "Zu installierende Geräte:",
+	"Devices to be unlocked:":                   "Zu entsperrende Geräte:",
+	"Devices to be locked:":                     "Zu sperrende Geräte:",
+	"Devices to be updated:":                    "Zu aktualisierende Geräte:",
+	"Failed to flash %d device(s)":              "Installation auf %d Gerät(en) fehlgeschlagen",
+	"Failed to unlock %d device(s)":             "Entsperren von %d Gerät(en) fehlgeschlagen",
+	"Failed to lock %d device(s)":               "Sperren von %d Gerät(en) fehlgeschlagen",
+	"Failed to update %d device(s)":             "Aktualisierung von %d Gerät(en) fehlgeschlagen",
+
+	"Unlocking %s bootloader...":            "Bootloader von %s wird entsperrt...",
+	"Unlocking (critical) %s bootloader...": "Bootloader von %s wird entsperrt (kritisch)...",
+	"Flashing %s bootloader...":             "%s wird installiert...",
+	"Locking %s bootloader...":              "Bootloader von %s wird gesperrt...",
+	"Rebooting %s...":                       "%s wird neu gestartet...",
+	"Rebooting %s into sideload mode...":    "%s wird im Sideload-Modus neu gestartet...",
+	"Sideloading to %s...":                  "Update wird an %s gesendet...",
+	"Sideloading %s... %d%%":                "Sende an %s... %d%%",
+	"Waiting for %s to reboot...":           "Warte auf den Neustart von %s...",
+	"Flashing complete":                     "Installation abgeschlossen",
+	"Unlocking complete":                    "Entsperren abgeschlossen",
+	"Locking complete":                      "Sperren abgeschlossen",
+	"Sideloading complete":                  "Aktualisierung abgeschlossen",
+
+	"Downloading %s":                 "Lade %s herunter",
+	"Downloading... %s downloaded":   "Herunterladen... %s heruntergeladen",
+	"Verifying %s":                   "Prüfe %s",
+	"Extracting %s":                  "Entpacke %s",
+	"%d file(s) failed verification": "%d Datei(en) haben die Prüfung nicht bestanden",
+	"Verification complete":          "Prüfung abgeschlossen",
+	"Download complete":              "Download abgeschlossen",
+
+	"SERIAL\tCODENAME\tMODE\tFACTORY IMAGE\tOTA":             "SERIENNUMMER\tCODENAME\tMODUS\tWERKSIMAGE\tOTA",
+	"Reboot into fastboot mode to read the bootloader state": "Im Fastboot-Modus neu starten, um den Bootloader-Status zu lesen",
+	"Product:":            "Produkt:",
+	"Variant:":            "Variante:",
+	"Slots:":              "Slots:",
+	"%d (current %s)":     "%d (aktuell %s)",
+	"Bootloader:":         "Bootloader:",
+	"locked":              "gesperrt",
+	"unlocked":            "entsperrt",
+	"unknown":             "unbekannt",
+	"Bootloader version:": "Bootloader-Version:",
+	"Baseband version:":   "Baseband-Version:",
+	"Max download size:":  "Maximale Downloadgröße:",
+	"Battery:":            "Akku:",
+	"Userspace fastboot:": "Fastboot im Userspace:",
+	"Partitions:":         "Partitionen:",
+	"logical":             "logisch",
+
+	"CODENAME":                        "CODENAME",
+	"SERIAL":                          "SERIENNUMMER",
+	"PHASE":                           "PHASE",
+	"PROGRESS":                        "FORTSCHRITT",
+	"ELAPSED":                         "DAUER",
+	"Waiting":                         "Wartet",
+	"Waiting for unlock confirmation": "Warte auf Bestätigung der Entsperrung",
+	"Waiting for critical unlock confirmation": "Warte auf Bestätigung der kritischen Entsperrung",
+	"Flashing":                         "Flashen",
+	"Flashing partition %d of %d (%s)": "Flashe Partition %d von %d (%s)",
+	"Waiting for lock confirmation":    "Warte auf Bestätigung der Sperrung",
+	"Rebooting":                        "Neustart",
+	"Rebooting into sideload mode":     "Neustart in den Sideload-Modus",
+	"Sideloading":                      "Update wird übertragen",
+	"Waiting for reboot":               "Warte auf Neustart",
+	"Done":                             "Fertig",
+	"Failed":                           "Fehlgeschlagen",
+	"ACTION REQUIRED ON THE PHONE":     "AKTION AM TELEFON ERFORDERLICH",
+	"Press Ctrl+C to stop":             "Strg+C zum Abbrechen drücken",
+
+	"Open http://%s in a browser to start flashing": "Öffne http://%s in einem Browser, um mit dem Flashen zu beginnen",
+	"Continue":       "Weiter",
+	"Factory images": "Werksimages",
+	"Start":          "Starten",
+	"Cancel":         "Abbrechen",
+	"Acknowledge":    "Bestätigen",
+	"Canceled":       "Abgebrochen",
+
+	"No factory images found in %s": "Keine Werksimages in %s gefunden",
+	"Anyone who can reach %s can flash the attached devices, consider setting a token": "Jeder, der %s erreichen kann, kann die angeschlossenen Geräte flashen, setze am besten ein Token",
+
+	"No devices recorded": "Keine Geräte erfasst",
+	"STARTED\tSERIAL\tASSET TAG\tCODENAME\tFACTORY IMAGE\tRESULT\tBOOTLOADER\tOPERATOR": "BEGINN\tSERIENNUMMER\tINVENTARNUMMER\tCODENAME\tWERKSIMAGE\tERGEBNIS\tBOOTLOADER\tBEDIENER",
+
+	"ASSET TAG":                  "INVENTARNUMMER",
+	"Scan or type the asset tag": "Inventarnummer scannen oder eingeben",
+
+	"Configuration file: %s":                            "Konfigurationsdatei: %s",
+	"No configuration file at %s, showing the defaults": "Keine Konfigurationsdatei unter %s, die Standardwerte werden angezeigt",
+
+	"No factory image of build %s for %s":                     "Kein Werksimage von Build %s für %s",
+	"Several factory images are available for %s:":            "Für %s sind mehrere Werksimages verfügbar:",
+	"Choose an image (1-%d), or press ENTER for the newest: ": "Wählen Sie ein Image (1-%d) oder drücken Sie ENTER für das neueste: ",
+
+	"Extracting... %s of %s": "Entpacken... %s von %s",
+
+	"Removed %d extraction(s), freeing %s": "%d Entpackung(en) entfernt, %s freigegeben",
+	"No extractions in %s":                 "Keine Entpackungen in %s",
+	"SHA-256\tZIP\tSIZE\tLAST USED\tSTATE": "SHA-256\tZIP\tGRÖSSE\tZULETZT VERWENDET\tZUSTAND",
+
+	"Running offline from a bundle made on %s":                               "Offline-Betrieb aus einem am %s erstellten Paket",
+	"The flasher runs from an offline bundle and does not download anything": "Der Installer läuft aus einem Offline-Paket und lädt nichts herunter",
+	"Adding %s":          "Füge %s hinzu",
+	"Adding... %s of %s": "Hinzufügen... %s von %s",
+	"%s does not match the manifest of the bundle":             "%s stimmt nicht mit dem Manifest des Pakets überein",
+	"%s is an extracted folder, only factory zips are bundled": "%s ist ein entpackter Ordner, nur Werksimage-Zips kommen ins Paket",
+	"No flasher for %s in %s, the bundle will not run there":   "Kein Installer für %s in %s, das Paket läuft dort nicht",
+	"Bundle written to %s (%s)":                                "Paket nach %s geschrieben (%s)",
+
+	"no factory image for %s":                   "kein Werksimage für %s",
+	"cannot check that %s can be flashed":       "kann nicht prüfen, ob %s geflasht werden kann",
+	"%s cannot be flashed with %s":              "%s kann nicht mit %s geflasht werden",
+	"failed to unlock %s bootloader":            "Entsperren des Bootloaders von %s fehlgeschlagen",
+	"failed to unlock (critical) %s bootloader": "Entsperren (kritisch) des Bootloaders von %s fehlgeschlagen",
+	"failed to flash %s":                        "Flashen von %s fehlgeschlagen",
+	"not locking bootloader of %s: fastboot flashing get_unlock_ability returned 0. Please visit https://calyxos.org/%s for more information": "Bootloader von %s wird nicht gesperrt: fastboot flashing get_unlock_ability hat 0 zurückgegeben. Weitere Informationen unter https://calyxos.org/%s",
+	"unable to determine if %s bootloader was locked":                   "kann nicht feststellen, ob der Bootloader von %s gesperrt wurde",
+	"failed to lock %s bootloader":                                      "Sperren des Bootloaders von %s fehlgeschlagen",
+	"no OTA image for %s":                                               "kein OTA-Image für %s",
+	"cannot read the build of %s":                                       "kann den Build von %s nicht lesen",
+	"failed to reboot %s into sideload mode, is USB debugging enabled?": "Neustart von %s in den Sideload-Modus fehlgeschlagen, ist USB-Debugging aktiviert?",
+	"timed out waiting for %s to enter sideload mode":                   "Zeitüberschreitung beim Warten auf den Sideload-Modus von %s",
+	"timed out waiting for %s to boot":                                  "Zeitüberschreitung beim Warten auf den Start von %s",
+	"failed to update %s: running %s, expected %s":                      "Aktualisierung von %s fehlgeschlagen: läuft mit %s, erwartet %s",
+	"Running %s hook for %s: %s":                                        "Führe Hook %s für %s aus: %s",
+	"%s hook failed for %s":                                             "Hook %s für %s fehlgeschlagen",
+
+	"%s is not in the manifest of the bundle": "%s ist nicht im Manifest des Pakets",
+
+	"Output in %s": "Ausgabe in %s",
+}
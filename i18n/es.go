@@ -0,0 +1,183 @@
+// Copyright 2020 CIS Maxwell, LLC. All rights reserved.
+// Copyright 2020 The Calyx Institute
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package i18n
+
+var es = Catalog{
+	"Android Factory Image Flasher version %s":                   "Instalador de imágenes de fábrica de Android, versión %s",
+	"Press enter to exit.":                                       "Pulsa Intro para salir.",
+	"Press ENTER to continue":                                    "Pulsa INTRO para continuar",
+	"Cannot continue without a factory image. Exiting...":        "No se puede continuar sin una imagen de fábrica. Saliendo...",
+	"Cannot continue without a device factory image. Exiting...": "No se puede continuar sin una imagen de fábrica para el dispositivo. Saliendo...",
+	"Cannot continue without a device OTA image. Exiting...":     "No se puede continuar sin una imagen OTA para el dispositivo. Saliendo...",
+	"Cannot continue without Android platform tools. Exiting...": "No se puede continuar sin las herramientas de plataforma de Android. Saliendo...",
+	"Cannot start ADB server":                                    "No se puede iniciar el servidor ADB",
+
+	"Connect to a Wi-Fi network and ensure that no SIM cards are installed":                        "Conéctate a una red Wi-Fi y asegúrate de que no haya ninguna tarjeta SIM insertada",
+	"Enable Developer Options on device (Settings -> About Phone -> tap \"Build number\" 7 times)": "Activa las Opciones para desarrolladores en el dispositivo (Ajustes -> Información del teléfono -> toca \"Número de compilación\" 7 veces)",
+	"Enable OEM Unlocking (Settings -> System -> Advanced -> Developer Options)":                   "Activa el Desbloqueo de OEM (Ajustes -> Sistema -> Avanzado -> Opciones para desarrolladores)",
+	"Disconnect the USB cable from your device":                                                    "Desconecta el cable USB del dispositivo",
+	"Power off your device": "Apaga el dispositivo",
+	"Hold volume down and connect the cable to boot it into fastboot mode.":                  "Mantén pulsado bajar volumen y conecta el cable para iniciarlo en modo fastboot.",
+	"Connect the device with USB debugging enabled, or in fastboot mode":                     "Conecta el dispositivo con la depuración por USB activada, o en modo fastboot",
+	"Enable USB debugging (Settings -> System -> Advanced -> Developer Options)":             "Activa la Depuración por USB (Ajustes -> Sistema -> Avanzado -> Opciones para desarrolladores)",
+	"Connect the cable and allow USB debugging on the device when asked":                     "Conecta el cable y permite la depuración por USB en el dispositivo cuando se te pida",
+	"Please use the volume and power keys on the device to unlock the bootloader":            "Usa los botones de volumen y de encendido del dispositivo para desbloquear el bootloader",
+	"Please use the volume and power keys on the device to unlock the bootloader (critical)": "Usa los botones de volumen y de encendido del dispositivo para desbloquear el bootloader (crítico)",
+	"Please use the volume and power keys on the device to lock the bootloader":              "Usa los botones de volumen y de encendido del dispositivo para bloquear el bootloader",
+	"Once %s boots, disconnect its cable and power it off":                                   "Cuando %s se inicie, desconecta su cable y apágalo",
+	"Then, hold %s and connect the cable again to boot it into fastboot mode.":               "Después, mantén pulsado %s y vuelve a conectar el cable para iniciarlo en modo fastboot.",
+	"volume up":   "subir volumen",
+	"volume down": "bajar volumen",
+	"The installation will resume automatically": "La instalación continuará automáticamente",
+
+	"Detected %s":                               "Detectado %s",
+	"No matching image found":                   "No se ha encontrado ninguna imagen compatible",
+	"More than one device detected. Exiting...": "Se ha detectado más de un dispositivo. Saliendo...",
+	"No devices detected":                       "No se ha detectado ningún dispositivo",
+	"No devices to be flashed. Exiting...":      "No hay dispositivos que instalar. Saliendo...",
+	"No devices to be unlocked. Exiting...":     "No hay dispositivos que desbloquear. Saliendo...",
+	"No devices to be locked. Exiting...":       "No hay dispositivos que bloquear. Saliendo...",
+	"No devices to be updated. Exiting...":      "No hay dispositivos que actualizar. Saliendo...",
+	"Devices to be flashed:":                    "Dispositivos que se van a instalar:",
+	"Devices to be unlocked:":                   "Dispositivos que se van a desbloquear:",
+	"Devices to be locked:":                     "Dispositivos que se van a bloquear:",
+	"Devices to be updated:":                    "Dispositivos que se van a actualizar:",
+	"Failed to flash %d device(s)":              "No se ha podido instalar %d dispositivo(s)",
+	"Failed to unlock %d device(s)":             "No se ha podido desbloquear %d dispositivo(s)",
+	"Failed to lock %d device(s)":               "No se ha podido bloquear %d dispositivo(s)",
+	"Failed to update %d device(s)":             "No se ha podido actualizar %d dispositivo(s)",
+
+	"Unlocking %s bootloader...":            "Desbloqueando el bootloader de %s...",
+	"Unlocking (critical) %s bootloader...": "Desbloqueando (crítico) el bootloader de %s...",
+	"Flashing %s bootloader...":             "Instalando %s...",
+	"Locking %s bootloader...":              "Bloqueando el bootloader de %s...",
+	"Rebooting %s...":                       "Reiniciando %s...",
+	"Rebooting %s into sideload mode...":    "Reiniciando %s en modo sideload...",
+	"Sideloading to %s...":                  "Enviando la actualización a %s...",
+	"Sideloading %s... %d%%":                "Enviando a %s... %d%%",
+	"Waiting for %s to reboot...":           "Esperando a que %s se reinicie...",
+	"Flashing complete":                     "Instalación completada",
+	"Unlocking complete":                    "Desbloqueo completado",
+	"Locking complete":                      "Bloqueo completado",
+	"Sideloading complete":                  "Actualización completada",
+
+	"Downloading %s":                 "Descargando %s",
+	"Downloading... %s downloaded":   "Descargando... %s descargados",
+	"Verifying %s":                   "Verificando %s",
+	"Extracting %s":                  "Extrayendo %s",
+	"%d file(s) failed verification": "%d archivo(s) no han superado la verificación",
+	"Verification complete":          "Verificación completada",
+	"Download complete":              "Descarga completada",
+
+	"SERIAL\tCODENAME\tMODE\tFACTORY IMAGE\tOTA":             "SERIE\tNOMBRE CLAVE\tMODO\tIMAGEN DE FÁBRICA\tOTA",
+	"Reboot into fastboot mode to read the bootloader state": "Reinicia en modo fastboot para leer el estado del bootloader",
+	"Product:":            "Producto:",
+	"Variant:":            "Variante:",
+	"Slots:":              "Ranuras:",
+	"%d (current %s)":     "%d (actual %s)",
+	"Bootloader:":         "Bootloader:",
+	"locked":              "bloqueado",
+	"unlocked":            "desbloqueado",
+	"unknown":             "desconocido",
+	"Bootloader version:": "Versión del bootloader:",
+	"Baseband version:":   "Versión de banda base:",
+	"Max download size:":  "Tamaño máximo de descarga:",
+	"Battery:":            "Batería:",
+	"Userspace fastboot:": "Fastboot en espacio de usuario:",
+	"Partitions:":         "Particiones:",
+	"logical":             "lógica",
+
+	"CODENAME":                        "NOMBRE CLAVE",
+	"SERIAL":                          "SERIE",
+	"PHASE":                           "FASE",
+	"PROGRESS":                        "PROGRESO",
+	"ELAPSED":                         "TIEMPO",
+	"Waiting":                         "En espera",
+	"Waiting for unlock confirmation": "Esperando la confirmación del desbloqueo",
+	"Waiting for critical unlock confirmation": "Esperando la confirmación del desbloqueo crítico",
+	"Flashing":                         "Instalando",
+	"Flashing partition %d of %d (%s)": "Instalando la partición %d de %d (%s)",
+	"Waiting for lock confirmation":    "Esperando la confirmación del bloqueo",
+	"Rebooting":                        "Reiniciando",
+	"Rebooting into sideload mode":     "Reiniciando en modo sideload",
+	"Sideloading":                      "Enviando la actualización",
+	"Waiting for reboot":               "Esperando el reinicio",
+	"Done":                             "Completado",
+	"Failed":                           "Error",
+	"ACTION REQUIRED ON THE PHONE":     "ACCIÓN NECESARIA EN EL TELÉFONO",
+	"Press Ctrl+C to stop":             "Pulsa Ctrl+C para detener",
+
+	"Open http://%s in a browser to start flashing": "Abre http://%s en un navegador para empezar la instalación",
+	"Continue":       "Continuar",
+	"Factory images": "Imágenes de fábrica",
+	"Start":          "Iniciar",
+	"Cancel":         "Cancelar",
+	"Acknowledge":    "Aceptar",
+	"Canceled":       "Cancelado",
+
+	"No factory images found in %s": "No se han encontrado imágenes de fábrica en %s",
+	"Anyone who can reach %s can flash the attached devices, consider setting a token": "Cualquiera que pueda acceder a %s puede instalar en los dispositivos conectados, considera configurar un token",
+
+	"No devices recorded": "No hay dispositivos registrados",
+	"STARTED\tSERIAL\tASSET TAG\tCODENAME\tFACTORY IMAGE\tRESULT\tBOOTLOADER\tOPERATOR": "INICIO\tSERIE\tETIQUETA\tNOMBRE CLAVE\tIMAGEN DE FÁBRICA\tRESULTADO\tBOOTLOADER\tOPERADOR",
+
+	"ASSET TAG":                  "ETIQUETA",
+	"Scan or type the asset tag": "Escanea o escribe la etiqueta de inventario",
+
+	"Configuration file: %s":                            "Archivo de configuración: %s",
+	"No configuration file at %s, showing the defaults": "No hay archivo de configuración en %s, se muestran los valores predeterminados",
+
+	"No factory image of build %s for %s":                     "No hay imagen de fábrica de la compilación %s para %s",
+	"Several factory images are available for %s:":            "Hay varias imágenes de fábrica disponibles para %s:",
+	"Choose an image (1-%d), or press ENTER for the newest: ": "Elija una imagen (1-%d) o pulse ENTER para la más reciente: ",
+
+	"Extracting... %s of %s": "Extrayendo... %s de %s",
+
+	"Removed %d extraction(s), freeing %s": "Se eliminaron %d extracciones, liberando %s",
+	"No extractions in %s":                 "No hay extracciones en %s",
+	"SHA-256\tZIP\tSIZE\tLAST USED\tSTATE": "SHA-256\tZIP\tTAMAÑO\tÚLTIMO USO\tESTADO",
+
+	"Running offline from a bundle made on %s":                               "Funcionando sin conexión desde un paquete creado el %s",
+	"The flasher runs from an offline bundle and does not download anything": "El instalador funciona desde un paquete sin conexión y no descarga nada",
+	"Adding %s":          "Añadiendo %s",
+	"Adding... %s of %s": "Añadiendo... %s de %s",
+	"%s does not match the manifest of the bundle":             "%s no coincide con el manifiesto del paquete",
+	"%s is an extracted folder, only factory zips are bundled": "%s es una carpeta extraída, solo se incluyen los zip de fábrica en el paquete",
+	"No flasher for %s in %s, the bundle will not run there":   "No hay instalador para %s en %s, el paquete no funcionará allí",
+	"Bundle written to %s (%s)":                                "Paquete escrito en %s (%s)",
+
+	"no factory image for %s":                   "no hay imagen de fábrica para %s",
+	"cannot check that %s can be flashed":       "no se puede comprobar que %s se pueda instalar",
+	"%s cannot be flashed with %s":              "%s no se puede instalar con %s",
+	"failed to unlock %s bootloader":            "no se pudo desbloquear el bootloader de %s",
+	"failed to unlock (critical) %s bootloader": "no se pudo desbloquear (crítico) el bootloader de %s",
+	"failed to flash %s":                        "no se pudo instalar %s",
+	"not locking bootloader of %s: fastboot flashing get_unlock_ability returned 0. Please visit https://calyxos.org/%s for more information": "no se bloquea el bootloader de %s: fastboot flashing get_unlock_ability devolvió 0. Visite https://calyxos.org/%s para más información",
+	"unable to determine if %s bootloader was locked":                   "no se pudo determinar si el bootloader de %s se bloqueó",
+	"failed to lock %s bootloader":                                      "no se pudo bloquear el bootloader de %s",
+	"no OTA image for %s":                                               "no hay imagen OTA para %s",
+	"cannot read the build of %s":                                       "no se puede leer la compilación de %s",
+	"failed to reboot %s into sideload mode, is USB debugging enabled?": "no se pudo reiniciar %s en modo sideload, ¿está activada la depuración USB?",
+	"timed out waiting for %s to enter sideload mode":                   "se agotó el tiempo de espera para que %s entre en modo sideload",
+	"timed out waiting for %s to boot":                                  "se agotó el tiempo de espera para que %s arranque",
+	"failed to update %s: running %s, expected %s":                      "no se pudo actualizar %s: ejecuta %s, se esperaba %s",
+	"Running %s hook for %s: %s":                                        "Ejecutando el hook %s para %s: %s",
+	"%s hook failed for %s":                                             "el hook %s falló para %s",
+
+	"%s is not in the manifest of the bundle": "%s no está en el manifiesto del paquete",
+
+	"Output in %s": "Salida en %s",
+}
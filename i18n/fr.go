@@ -0,0 +1,183 @@
+// Copyright 2020 CIS Maxwell, LLC. All rights reserved.
+// Copyright 2020 The Calyx Institute
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package i18n
+
+var fr = Catalog{
+	"Android Factory Image Flasher version %s":                   "Installateur d'images d'usine Android, version %s",
+	"Press enter to exit.":                                       "Appuyez sur Entrée pour quitter.",
+	"Press ENTER to continue":                                    "Appuyez sur ENTRÉE pour continuer",
+	"Cannot continue without a factory image. Exiting...":        "Impossible de continuer sans image d'usine. Arrêt...",
+	"Cannot continue without a device factory image. Exiting...": "Impossible de continuer sans image d'usine pour l'appareil. Arrêt...",
+	"Cannot continue without a device OTA image. Exiting...":     "Impossible de continuer sans image OTA pour l'appareil. Arrêt...",
+	"Cannot continue without Android platform tools. Exiting...": "Impossible de continuer sans les outils de plateforme Android. Arrêt...",
+	"Cannot start ADB server":                                    "Impossible de démarrer le serveur ADB",
+
+	"Connect to a Wi-Fi network and ensure that no SIM cards are installed":                        "Connectez-vous à un réseau Wi-Fi et vérifiez qu'aucune carte SIM n'est insérée",
+	"Enable Developer Options on device (Settings -> About Phone -> tap \"Build number\" 7 times)": "Activez les Options pour les développeurs sur l'appareil (Paramètres -> À propos du téléphone -> appuyez 7 fois sur \"Numéro de build\")",
+	"Enable OEM Unlocking (Settings -> System -> Advanced -> Developer Options)":                   "Activez le Déverrouillage OEM (Paramètres -> Système -> Paramètres avancés -> Options pour les développeurs)",
+	"Disconnect the USB cable from your device":                                                    "Débranchez le câble USB de votre appareil",
+	"Power off your device": "Éteignez votre appareil",
+	"Hold volume down and connect the cable to boot it into fastboot mode.":                  "Maintenez la touche volume bas et branchez le câble pour démarrer en mode fastboot.",
+	"Connect the device with USB debugging enabled, or in fastboot mode":                     "Branchez l'appareil avec le débogage USB activé, ou en mode fastboot",
+	"Enable USB debugging (Settings -> System -> Advanced -> Developer Options)":             "Activez le Débogage USB (Paramètres -> Système -> Paramètres avancés -> Options pour les développeurs)",
+	"Connect the cable and allow USB debugging on the device when asked":                     "Branchez le câble et autorisez le débogage USB sur l'appareil lorsque c'est demandé",
+	"Please use the volume and power keys on the device to unlock the bootloader":            "Utilisez les touches de volume et d'alimentation de l'appareil pour déverrouiller le bootloader",
+	"Please use the volume and power keys on the device to unlock the bootloader (critical)": "Utilisez les touches de volume et d'alimentation de l'appareil pour déverrouiller le bootloader (critique)",
+	"Please use the volume and power keys on the device to lock the bootloader":              "Utilisez les touches de volume et d'alimentation de l'appareil pour verrouiller le bootloader",
+	"Once %s boots, disconnect its cable and power it off":                                   "Une fois %s démarré, débranchez son câble et éteignez-le",
+	"Then, hold %s and connect the cable again to boot it into fastboot mode.":               "Ensuite, maintenez la touche %s et rebranchez le câble pour démarrer en mode fastboot.",
+	"volume up":   "volume haut",
+	"volume down": "volume bas",
+	"The installation will resume automatically": "L'installation reprendra automatiquement",
+
+	"Detected %s":                               "%s détecté",
+	"No matching image found":                   "Aucune image correspondante trouvée",
+	"More than one device detected. Exiting...": "Plus d'un appareil détecté. Arrêt...",
+	"No devices detected":                       "Aucun appareil détecté",
+	"No devices to be flashed. Exiting...":      "Aucun appareil à installer. Arrêt...",
+	"No devices to be unlocked. Exiting...":     "Aucun appareil à déverrouiller. Arrêt...",
+	"No devices to be locked. Exiting...":       "Aucun appareil à verrouiller. Arrêt...",
+	"No devices to be updated. Exiting...":      "Aucun appareil à mettre à jour. Arrêt...",
+	"Devices to be flashed:":                    "Appareils à installer :",
+	"Devices to be unlocked:":                   "Appareils à déverrouiller :",
+	"Devices to be locked:":                     "Appareils à verrouiller :",
+	"Devices to be updated:":                    "Appareils à mettre à jour :",
+	"Failed to flash %d device(s)":              "Échec de l'installation de %d appareil(s)",
+	"Failed to unlock %d device(s)":             "Échec du déverrouillage de %d appareil(s)",
+	"Failed to lock %d device(s)":               "Échec du verrouillage de %d appareil(s)",
+	"Failed to update %d device(s)":             "Échec de la mise à jour de %d appareil(s)",
+
+	"Unlocking %s bootloader...":            "Déverrouillage du bootloader de %s...",
+	"Unlocking (critical) %s bootloader...": "Déverrouillage (critique) du bootloader de %s...",
+	"Flashing %s bootloader...":             "Installation de %s...",
+	"Locking %s bootloader...":              "Verrouillage du bootloader de %s...",
+	"Rebooting %s...":                       "Redémarrage de %s...",
+	"Rebooting %s into sideload mode...":    "Redémarrage de %s en mode sideload...",
+	"Sideloading to %s...":                  "Envoi de la mise à jour vers %s...",
+	"Sideloading %s... %d%%":                "Envoi vers %s... %d%%",
+	"Waiting for %s to reboot...":           "Attente du redémarrage de %s...",
+	"Flashing complete":                     "Installation terminée",
+	"Unlocking complete":                    "Déverrouillage terminé",
+	"Locking complete":                      "Verrouillage terminé",
+	"Sideloading complete":                  "Mise à jour terminée",
+
+	"Downloading %s":                 "Téléchargement de %s",
+	"Downloading... %s downloaded":   "Téléchargement... %s téléchargés",
+	"Verifying %s":                   "Vérification de %s",
+	"Extracting %s":                  "Extraction de %s",
+	"%d file(s) failed verification": "%d fichier(s) n'ont pas passé la vérification",
+	"Verification complete":          "Vérification terminée",
+	"Download complete":              "Téléchargement terminé",
+
+	"SERIAL\tCODENAME\tMODE\tFACTORY IMAGE\tOTA":             "NUMÉRO DE SÉRIE\tNOM DE CODE\tMODE\tIMAGE D'USINE\tOTA",
+	"Reboot into fastboot mode to read the bootloader state": "Redémarrez en mode fastboot pour lire l'état du bootloader",
+	"Product:":            "Produit :",
+	"Variant:":            "Variante :",
+	"Slots:":              "Emplacements :",
+	"%d (current %s)":     "%d (actuel %s)",
+	"Bootloader:":         "Bootloader :",
+	"locked":              "verrouillé",
+	"unlocked":            "déverrouillé",
+	"unknown":             "inconnu",
+	"Bootloader version:": "Version du bootloader :",
+	"Baseband version:":   "Version de la bande de base :",
+	"Max download size:":  "Taille de téléchargement maximale :",
+	"Battery:":            "Batterie :",
+	"Userspace fastboot:": "Fastboot en espace utilisateur :",
+	"Partitions:":         "Partitions :",
+	"logical":             "logique",
+
+	"CODENAME":                        "NOM DE CODE",
+	"SERIAL":                          "NUMÉRO DE SÉRIE",
+	"PHASE":                           "ÉTAPE",
+	"PROGRESS":                        "PROGRESSION",
+	"ELAPSED":                         "DURÉE",
+	"Waiting":                         "En attente",
+	"Waiting for unlock confirmation": "En attente de la confirmation du déverrouillage",
+	"Waiting for critical unlock confirmation": "En attente de la confirmation du déverrouillage critique",
+	"Flashing":                         "Installation",
+	"Flashing partition %d of %d (%s)": "Installation de la partition %d sur %d (%s)",
+	"Waiting for lock confirmation":    "En attente de la confirmation du verrouillage",
+	"Rebooting":                        "Redémarrage",
+	"Rebooting into sideload mode":     "Redémarrage en mode sideload",
+	"Sideloading":                      "Envoi de la mise à jour",
+	"Waiting for reboot":               "En attente du redémarrage",
+	"Done":                             "Terminé",
+	"Failed":                           "Échec",
+	"ACTION REQUIRED ON THE PHONE":     "ACTION REQUISE SUR LE TÉLÉPHONE",
+	"Press Ctrl+C to stop":             "Appuyez sur Ctrl+C pour arrêter",
+
+	"Open http://%s in a browser to start flashing": "Ouvrez http://%s dans un navigateur pour commencer l'installation",
+	"Continue":       "Continuer",
+	"Factory images": "Images d'usine",
+	"Start":          "Démarrer",
+	"Cancel":         "Annuler",
+	"Acknowledge":    "Compris",
+	"Canceled":       "Annulé",
+
+	"No factory images found in %s": "Aucune image d'usine trouvée dans %s",
+	"Anyone who can reach %s can flash the attached devices, consider setting a token": "Toute personne pouvant accéder à %s peut flasher les appareils connectés, pensez à définir un jeton",
+
+	"No devices recorded": "Aucun appareil enregistré",
+	"STARTED\tSERIAL\tASSET TAG\tCODENAME\tFACTORY IMAGE\tRESULT\tBOOTLOADER\tOPERATOR": "DÉBUT\tNUMÉRO DE SÉRIE\tÉTIQUETTE\tNOM DE CODE\tIMAGE D'USINE\tRÉSULTAT\tBOOTLOADER\tOPÉRATEUR",
+
+	"ASSET TAG":                  "ÉTIQUETTE",
+	"Scan or type the asset tag": "Scannez ou saisissez l'étiquette d'inventaire",
+
+	"Configuration file: %s":                            "Fichier de configuration : %s",
+	"No configuration file at %s, showing the defaults": "Aucun fichier de configuration dans %s, affichage des valeurs par défaut",
+
+	"No factory image of build %s for %s":                     "Aucune image d'usine de la version %s pour %s",
+	"Several factory images are available for %s:":            "Plusieurs images d'usine sont disponibles pour %s :",
+	"Choose an image (1-%d), or press ENTER for the newest: ": "Choisissez une image (1-%d) ou appuyez sur ENTRÉE pour la plus récente : ",
+
+	"Extracting... %s of %s": "Extraction... %s sur %s",
+
+	"Removed %d extraction(s), freeing %s": "%d extraction(s) supprimée(s), %s libéré(s)",
+	"No extractions in %s":                 "Aucune extraction dans %s",
+	"SHA-256\tZIP\tSIZE\tLAST USED\tSTATE": "SHA-256\tZIP\tTAILLE\tDERNIÈRE UTILISATION\tÉTAT",
+
+	"Running offline from a bundle made on %s":                               "Fonctionnement hors ligne depuis un paquet créé le %s",
+	"The flasher runs from an offline bundle and does not download anything": "L'installateur fonctionne depuis un paquet hors ligne et ne télécharge rien",
+	"Adding %s":          "Ajout de %s",
+	"Adding... %s of %s": "Ajout... %s sur %s",
+	"%s does not match the manifest of the bundle":             "%s ne correspond pas au manifeste du paquet",
+	"%s is an extracted folder, only factory zips are bundled": "%s est un dossier extrait, seuls les zip d'usine sont ajoutés au paquet",
+	"No flasher for %s in %s, the bundle will not run there":   "Aucun installateur pour %s dans %s, le paquet ne fonctionnera pas sur ce système",
+	"Bundle written to %s (%s)":                                "Paquet écrit dans %s (%s)",
+
+	"no factory image for %s":                   "aucune image d'usine pour %s",
+	"cannot check that %s can be flashed":       "impossible de vérifier que %s peut être flashé",
+	"%s cannot be flashed with %s":              "%s ne peut pas être flashé avec %s",
+	"failed to unlock %s bootloader":            "échec du déverrouillage du bootloader de %s",
+	"failed to unlock (critical) %s bootloader": "échec du déverrouillage (critique) du bootloader de %s",
+	"failed to flash %s":                        "échec du flash de %s",
+	"not locking bootloader of %s: fastboot flashing get_unlock_ability returned 0. Please visit https://calyxos.org/%s for more information": "le bootloader de %s n'est pas verrouillé : fastboot flashing get_unlock_ability a renvoyé 0. Consultez https://calyxos.org/%s pour plus d'informations",
+	"unable to determine if %s bootloader was locked":                   "impossible de déterminer si le bootloader de %s a été verrouillé",
+	"failed to lock %s bootloader":                                      "échec du verrouillage du bootloader de %s",
+	"no OTA image for %s":                                               "aucune image OTA pour %s",
+	"cannot read the build of %s":                                       "impossible de lire la version de %s",
+	"failed to reboot %s into sideload mode, is USB debugging enabled?": "échec du redémarrage de %s en mode sideload, le débogage USB est-il activé ?",
+	"timed out waiting for %s to enter sideload mode":                   "délai dépassé en attendant que %s passe en mode sideload",
+	"timed out waiting for %s to boot":                                  "délai dépassé en attendant que %s démarre",
+	"failed to update %s: running %s, expected %s":                      "échec de la mise à jour de %s : exécute %s, %s attendu",
+	"Running %s hook for %s: %s":                                        "Exécution du hook %s pour %s : %s",
+	"%s hook failed for %s":                                             "échec du hook %s pour %s",
+
+	"%s is not in the manifest of the bundle": "%s n'est pas dans le manifeste du paquet",
+
+	"Output in %s": "Sortie dans %s",
+}
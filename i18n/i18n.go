@@ -0,0 +1,97 @@
+// Copyright 2020 CIS Maxwell, LLC. All rights reserved.
+// Copyright 2020 The Calyx Institute
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package i18n translates the flasher's messages.
+//
+// Messages are looked up by their English fmt format string, so untranslated
+// messages, and languages without a catalog, fall back to English.
+package i18n
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Catalog maps English format strings to their translation.
+type Catalog map[string]string
+
+var catalogs = map[string]Catalog{
+	"de": de,
+	"es": es,
+	"fr": fr,
+	"pt": pt,
+}
+
+// Languages returns the languages with a catalog, English included.
+func Languages() []string {
+	languages := []string{"en"}
+	for lang := range catalogs {
+		languages = append(languages, lang)
+	}
+	sort.Strings(languages)
+	return languages
+}
+
+// Printer formats messages in one language.
+type Printer struct {
+	lang    string
+	catalog Catalog
+}
+
+// NewPrinter returns a Printer for a locale such as es, pt_BR or fr_FR.UTF-8.
+// Locales without a catalog get English.
+func NewPrinter(locale string) *Printer {
+	lang := Match(locale)
+	return &Printer{lang: lang, catalog: catalogs[lang]}
+}
+
+// Lang returns the language messages are printed in.
+func (p *Printer) Lang() string {
+	return p.lang
+}
+
+// Sprintf formats the translation of format.
+func (p *Printer) Sprintf(format string, args ...interface{}) string {
+	if translation, ok := p.catalog[format]; ok {
+		format = translation
+	}
+	return fmt.Sprintf(format, args...)
+}
+
+// Match returns the language with a catalog matching locale, or en.
+func Match(locale string) string {
+	// pt_BR.UTF-8@euro -> pt
+	lang := strings.ToLower(locale)
+	if i := strings.IndexAny(lang, "_-.@"); i >= 0 {
+		lang = lang[:i]
+	}
+	if _, ok := catalogs[lang]; ok {
+		return lang
+	}
+	return "en"
+}
+
+// Locale returns the locale of the environment: LC_ALL, LC_MESSAGES or LANG,
+// or the user's display language on Windows.
+func Locale() string {
+	for _, name := range []string{"LC_ALL", "LC_MESSAGES", "LANG"} {
+		if locale := os.Getenv(name); locale != "" && locale != "C" && locale != "POSIX" {
+			return locale
+		}
+	}
+	return systemLocale()
+}
@@ -0,0 +1,183 @@
+// Copyright 2020 CIS Maxwell, LLC. All rights reserved.
+// Copyright 2020 The Calyx Institute
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package i18n
+
+var pt = Catalog{
+	"Android Factory Image Flasher version %s":                   "Instalador de imagens de fábrica do Android, versão %s",
+	"Press enter to exit.":                                       "Pressione Enter para sair.",
+	"Press ENTER to continue":                                    "Pressione ENTER para continuar",
+	"Cannot continue without a factory image. Exiting...":        "Não é possível continuar sem uma imagem de fábrica. Saindo...",
+	"Cannot continue without a device factory image. Exiting...": "Não é possível continuar sem uma imagem de fábrica para o dispositivo. Saindo...",
+	"Cannot continue without a device OTA image. Exiting...":     "Não é possível continuar sem uma imagem OTA para o dispositivo. Saindo...",
+	"Cannot continue without Android platform tools. Exiting...": "Não é possível continuar sem as ferramentas de plataforma do Android. Saindo...",
+	"Cannot start ADB server":                                    "Não foi possível iniciar o servidor ADB",
+
+	"Connect to a Wi-Fi network and ensure that no SIM cards are installed":                        "Conecte-se a uma rede Wi-Fi e verifique se não há nenhum chip SIM inserido",
+	"Enable Developer Options on device (Settings -> About Phone -> tap \"Build number\" 7 times)": "Ative as Opções do desenvolvedor no dispositivo (Configurações -> Sobre o telefone -> toque 7 vezes em \"Número da versão\")",
+	"Enable OEM Unlocking (Settings -> System -> Advanced -> Developer Options)":                   "Ative o Desbloqueio de OEM (Configurações -> Sistema -> Avançado -> Opções do desenvolvedor)",
+	"Disconnect the USB cable from your device":                                                    "Desconecte o cabo USB do dispositivo",
+	"Power off your device": "Desligue o dispositivo",
+	"Hold volume down and connect the cable to boot it into fastboot mode.":                  "Segure o botão de diminuir volume e conecte o cabo para iniciar no modo fastboot.",
+	"Connect the device with USB debugging enabled, or in fastboot mode":                     "Conecte o dispositivo com a depuração USB ativada, ou no modo fastboot",
+	"Enable USB debugging (Settings -> System -> Advanced -> Developer Options)":             "Ative a Depuração USB (Configurações -> Sistema -> Avançado -> Opções do desenvolvedor)",
+	"Connect the cable and allow USB debugging on the device when asked":                     "Conecte o cabo e permita a depuração USB no dispositivo quando solicitado",
+	"Please use the volume and power keys on the device to unlock the bootloader":            "Use os botões de volume e liga/desliga do dispositivo para desbloquear o bootloader",
+	"Please use the volume and power keys on the device to unlock the bootloader (critical)": "Use os botões de volume e liga/desliga do dispositivo para desbloquear o bootloader (crítico)",
+	"Please use the volume and power keys on the device to lock the bootloader":              "Use os botões de volume e liga/desliga do dispositivo para bloquear o bootloader",
+	"Once %s boots, disconnect its cable and power it off":                                   "Quando %s iniciar, desconecte o cabo e desligue-o",
+	"Then, hold %s and connect the cable again to boot it into fastboot mode.":               "Depois, segure o botão de %s e conecte o cabo novamente para iniciar no modo fastboot.",
+	"volume up":   "aumentar volume",
+	"volume down": "diminuir volume",
+	"The installation will resume automatically": "A instalação continuará automaticamente",
+
+	"Detected %s":                               "Detectado %s",
+	"No matching image found":                   "Nenhuma imagem compatível encontrada",
+	"More than one device detected. Exiting...": "Mais de um dispositivo detectado. Saindo...",
+	"No devices detected":                       "Nenhum dispositivo detectado",
+	"No devices to be flashed. Exiting...":      "Nenhum dispositivo para instalar. Saindo...",
+	"No devices to be unlocked. Exiting...":     "Nenhum dispositivo para desbloquear. Saindo...",
+	"No devices to be locked. Exiting...":       "Nenhum dispositivo para bloquear. Saindo...",
+	"No devices to be updated. Exiting...":      "Nenhum dispositivo para atualizar. Saindo...",
+	"Devices to be flashed:":                    "Dispositivos a instalar:",
+	"Devices to be unlocked:":                   "Dispositivos a desbloquear:",
+	"Devices to be locked:":                     "Dispositivos a bloquear:",
+	"Devices to be updated:":                    "Dispositivos a atualizar:",
+	"Failed to flash %d device(s)":              "Falha ao instalar %d dispositivo(s)",
+	"Failed to unlock %d device(s)":             "Falha ao desbloquear %d dispositivo(s)",
+	"Failed to lock %d device(s)":               "Falha ao bloquear %d dispositivo(s)",
+	"Failed to update %d device(s)":             "Falha ao atualizar %d dispositivo(s)",
+
+	"Unlocking %s bootloader...":            "Desbloqueando o bootloader de %s...",
+	"Unlocking (critical) %s bootloader...": "Desbloqueando (crítico) o bootloader de %s...",
+	"Flashing %s bootloader...":             "Instalando %s...",
+	"Locking %s bootloader...":              "Bloqueando o bootloader de %s...",
+	"Rebooting %s...":                       "Reiniciando %s...",
+	"Rebooting %s into sideload mode...":    "Reiniciando %s no modo sideload...",
+	"Sideloading to %s...":                  "Enviando a atualização para %s...",
+	"Sideloading %s... %d%%":                "Enviando para %s... %d%%",
+	"Waiting for %s to reboot...":           "Aguardando %s reiniciar...",
+	"Flashing complete":                     "Instalação concluída",
+	"Unlocking complete":                    "Desbloqueio concluído",
+	"Locking complete":                      "Bloqueio concluído",
+	"Sideloading complete":                  "Atualização concluída",
+
+	"Downloading %s":                 "Baixando %s",
+	"Downloading... %s downloaded":   "Baixando... %s baixados",
+	"Verifying %s":                   "Verificando %s",
+	"Extracting %s":                  "Extraindo %s",
+	"%d file(s) failed verification": "%d arquivo(s) falharam na verificação",
+	"Verification complete":          "Verificação concluída",
+	"Download complete":              "Download concluído",
+
+	"SERIAL\tCODENAME\tMODE\tFACTORY IMAGE\tOTA":             "SERIAL\tCODINOME\tMODO\tIMAGEM DE FÁBRICA\tOTA",
+	"Reboot into fastboot mode to read the bootloader state": "Reinicie no modo fastboot para ler o estado do bootloader",
+	"Product:":            "Produto:",
+	"Variant:":            "Variante:",
+	"Slots:":              "Slots:",
+	"%d (current %s)":     "%d (atual %s)",
+	"Bootloader:":         "Bootloader:",
+	"locked":              "bloqueado",
+	"unlocked":            "desbloqueado",
+	"unknown":             "desconhecido",
+	"Bootloader version:": "Versão do bootloader:",
+	"Baseband version:":   "Versão da banda base:",
+	"Max download size:":  "Tamanho máximo de download:",
+	"Battery:":            "Bateria:",
+	"Userspace fastboot:": "Fastboot no espaço do usuário:",
+	"Partitions:":         "Partições:",
+	"logical":             "lógica",
+
+	"CODENAME":                        "CODINOME",
+	"SERIAL":                          "SERIAL",
+	"PHASE":                           "ETAPA",
+	"PROGRESS":                        "PROGRESSO",
+	"ELAPSED":                         "TEMPO",
+	"Waiting":                         "Aguardando",
+	"Waiting for unlock confirmation": "Aguardando a confirmação do desbloqueio",
+	"Waiting for critical unlock confirmation": "Aguardando a confirmação do desbloqueio crítico",
+	"Flashing":                         "Instalando",
+	"Flashing partition %d of %d (%s)": "Instalando a partição %d de %d (%s)",
+	"Waiting for lock confirmation":    "Aguardando a confirmação do bloqueio",
+	"Rebooting":                        "Reiniciando",
+	"Rebooting into sideload mode":     "Reiniciando no modo sideload",
+	"Sideloading":                      "Enviando a atualização",
+	"Waiting for reboot":               "Aguardando a reinicialização",
+	"Done":                             "Concluído",
+	"Failed":                           "Falhou",
+	"ACTION REQUIRED ON THE PHONE":     "AÇÃO NECESSÁRIA NO TELEFONE",
+	"Press Ctrl+C to stop":             "Pressione Ctrl+C para parar",
+
+	"Open http://%s in a browser to start flashing": "Abra http://%s em um navegador para iniciar a instalação",
+	"Continue":       "Continuar",
+	"Factory images": "Imagens de fábrica",
+	"Start":          "Iniciar",
+	"Cancel":         "Cancelar",
+	"Acknowledge":    "Confirmar",
+	"Canceled":       "Cancelado",
+
+	"No factory images found in %s": "Nenhuma imagem de fábrica encontrada em %s",
+	"Anyone who can reach %s can flash the attached devices, consider setting a token": "Qualquer pessoa que acesse %s pode instalar nos dispositivos conectados, considere definir um token",
+
+	"No devices recorded": "Nenhum dispositivo registrado",
+	"STARTED\tSERIAL\tASSET TAG\tCODENAME\tFACTORY IMAGE\tRESULT\tBOOTLOADER\tOPERATOR": "INÍCIO\tSERIAL\tETIQUETA\tCODINOME\tIMAGEM DE FÁBRICA\tRESULTADO\tBOOTLOADER\tOPERADOR",
+
+	"ASSET TAG":                  "ETIQUETA",
+	"Scan or type the asset tag": "Escaneie ou digite a etiqueta de patrimônio",
+
+	"Configuration file: %s":                            "Arquivo de configuração: %s",
+	"No configuration file at %s, showing the defaults": "Nenhum arquivo de configuração em %s, mostrando os valores padrão",
+
+	"No factory image of build %s for %s":                     "Nenhuma imagem de fábrica da compilação %s para %s",
+	"Several factory images are available for %s:":            "Várias imagens de fábrica estão disponíveis para %s:",
+	"Choose an image (1-%d), or press ENTER for the newest: ": "Escolha uma imagem (1-%d) ou pressione ENTER para a mais recente: ",
+
+	"Extracting... %s of %s": "Extraindo... %s de %s",
+
+	"Removed %d extraction(s), freeing %s": "%d extração(ões) removida(s), liberando %s",
+	"No extractions in %s":                 "Nenhuma extração em %s",
+	"SHA-256\tZIP\tSIZE\tLAST USED\tSTATE": "SHA-256\tZIP\tTAMANHO\tÚLTIMO USO\tESTADO",
+
+	"Running offline from a bundle made on %s":                               "Funcionando offline a partir de um pacote criado em %s",
+	"The flasher runs from an offline bundle and does not download anything": "O instalador funciona a partir de um pacote offline e não baixa nada",
+	"Adding %s":          "Adicionando %s",
+	"Adding... %s of %s": "Adicionando... %s de %s",
+	"%s does not match the manifest of the bundle":             "%s não corresponde ao manifesto do pacote",
+	"%s is an extracted folder, only factory zips are bundled": "%s é uma pasta extraída, apenas os zips de fábrica entram no pacote",
+	"No flasher for %s in %s, the bundle will not run there":   "Nenhum instalador para %s em %s, o pacote não funcionará lá",
+	"Bundle written to %s (%s)":                                "Pacote gravado em %s (%s)",
+
+	"no factory image for %s":                   "nenhuma imagem de fábrica para %s",
+	"cannot check that %s can be flashed":       "não é possível verificar se %s pode ser instalado",
+	"%s cannot be flashed with %s":              "%s não pode ser instalado com %s",
+	"failed to unlock %s bootloader":            "falha ao desbloquear o bootloader de %s",
+	"failed to unlock (critical) %s bootloader": "falha ao desbloquear (crítico) o bootloader de %s",
+	"failed to flash %s":                        "falha ao instalar %s",
+	"not locking bootloader of %s: fastboot flashing get_unlock_ability returned 0. Please visit https://calyxos.org/%s for more information": "o bootloader de %s não será bloqueado: fastboot flashing get_unlock_ability retornou 0. Visite https://calyxos.org/%s para mais informações",
+	"unable to determine if %s bootloader was locked":                   "não foi possível determinar se o bootloader de %s foi bloqueado",
+	"failed to lock %s bootloader":                                      "falha ao bloquear o bootloader de %s",
+	"no OTA image for %s":                                               "nenhuma imagem OTA para %s",
+	"cannot read the build of %s":                                       "não é possível ler a versão de %s",
+	"failed to reboot %s into sideload mode, is USB debugging enabled?": "falha ao reiniciar %s no modo sideload, a depuração USB está ativada?",
+	"timed out waiting for %s to enter sideload mode":                   "tempo esgotado esperando %s entrar no modo sideload",
+	"timed out waiting for %s to boot":                                  "tempo esgotado esperando %s inicializar",
+	"failed to update %s: running %s, expected %s":                      "falha ao atualizar %s: executando %s, esperado %s",
+	"Running %s hook for %s: %s":                                        "Executando o hook %s para %s: %s",
+	"%s hook failed for %s":                                             "o hook %s falhou para %s",
+
+	"%s is not in the manifest of the bundle": "%s não está no manifesto do pacote",
+
+	"Output in %s": "Saída em %s",
+}
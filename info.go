@@ -0,0 +1,111 @@
+// Copyright 2020 CIS Maxwell, LLC. All rights reserved.
+// Copyright 2020 The Calyx Institute
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"gitlab.com/calyxos/device-flasher/device"
+	"gitlab.com/calyxos/device-flasher/internal/humanize"
+)
+
+func infoCommand(o *options, args []string) {
+	out := os.Stdout
+	if o.json {
+		// Keep stdout for the JSON document
+		out = os.Stderr
+	}
+	flasher := startPlatformTools(o, out)
+	detected, err := flasher.Client.Devices(context.Background())
+	if err != nil {
+		// The devices adb or fastboot found are still described
+		errorln(err, len(detected) == 0)
+	}
+	devices := []*device.Device{}
+	for _, d := range detected {
+		if o.serial == "" || d.Serial == o.serial {
+			devices = append(devices, d)
+		}
+	}
+	if o.json {
+		printJSON(devices)
+		return
+	}
+	if len(devices) == 0 {
+		fmt.Println(tr("No devices detected"))
+	}
+	for _, d := range devices {
+		fmt.Println()
+		printInfo(d, flasher.Client.Profile(d.Codename))
+	}
+}
+
+func printJSON(v interface{}) {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(v); err != nil {
+		errorln(err, true)
+	}
+}
+
+func printInfo(d *device.Device, profile device.Profile) {
+	fmt.Println(Blue(d.String() + " (" + string(d.Mode) + ")"))
+	if d.Info == nil {
+		fmt.Println("  " + tr("Reboot into fastboot mode to read the bootloader state"))
+		return
+	}
+	i := d.Info
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "  %s\t%s\n", tr("Product:"), i.Product)
+	if i.Variant != "" {
+		fmt.Fprintf(w, "  %s\t%s\n", tr("Variant:"), i.Variant)
+	}
+	fmt.Fprintf(w, "  %s\t%s\n", tr("Slots:"), tr("%d (current %s)", i.SlotCount, i.CurrentSlot))
+	state := tr("unknown")
+	switch i.LockState(profile) {
+	case device.Locked:
+		state = tr("locked")
+	case device.Unlocked:
+		state = tr("unlocked")
+	}
+	fmt.Fprintf(w, "  %s\t%s\n", tr("Bootloader:"), state)
+	fmt.Fprintf(w, "  %s\t%s\n", tr("Bootloader version:"), i.BootloaderVersion)
+	fmt.Fprintf(w, "  %s\t%s\n", tr("Baseband version:"), i.BasebandVersion)
+	fmt.Fprintf(w, "  %s\t%s\n", tr("Max download size:"), humanize.Bytes(i.MaxDownloadSize))
+	battery := tr("unknown")
+	if i.BatteryVoltage > 0 {
+		battery = strconv.Itoa(i.BatteryVoltage) + " mV"
+	}
+	if i.BatterySocOk != "" {
+		battery += " (soc ok: " + i.BatterySocOk + ")"
+	}
+	fmt.Fprintf(w, "  %s\t%s\n", tr("Battery:"), battery)
+	fmt.Fprintf(w, "  %s\t%t\n", tr("Userspace fastboot:"), i.IsUserspace)
+	fmt.Fprintf(w, "  %s\t%d\n", tr("Partitions:"), len(i.Partitions))
+	for _, p := range i.Partitions {
+		logical := ""
+		if p.Logical {
+			logical = tr("logical")
+		}
+		fmt.Fprintf(w, "    %s\t%s\t%s %s\n", p.Name, humanize.Bytes(p.Size), p.Type, logical)
+	}
+	w.Flush()
+}
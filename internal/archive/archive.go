@@ -0,0 +1,261 @@
+// Copyright 2020 CIS Maxwell, LLC. All rights reserved.
+// Copyright 2020 The Calyx Institute
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package archive extracts and verifies the zips the flasher works with.
+package archive
+
+import (
+	"archive/zip"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gitlab.com/calyxos/device-flasher/internal/disk"
+	"gitlab.com/calyxos/device-flasher/progress"
+)
+
+// Limits bound what Extract writes, against malformed and malicious zips.
+// A zero field is not enforced.
+type Limits struct {
+	// Size is the most bytes written for the whole zip.
+	Size uint64
+	// Files is the most entries the zip may hold.
+	Files int
+	// Ratio is the most a file of more than a MiB may expand to, relative to its compressed size.
+	Ratio uint64
+}
+
+// DefaultLimits fit the factory images and platform tools with room to spare.
+var DefaultLimits = Limits{Size: 32 << 30, Files: 10000, Ratio: 1000}
+
+// Extract unpacks src into destination within DefaultLimits, and returns the
+// paths it created, in zip order.
+func Extract(src, destination string, report progress.Func) ([]string, error) {
+	return DefaultLimits.Extract(src, destination, report)
+}
+
+// Extract unpacks src into destination within l, reporting the bytes written.
+// Only directories and regular files are extracted, the latter readable by
+// everyone and executable when they were in the zip or are shell scripts.
+// Everything is first extracted into a temporary folder in destination, then
+// the folders and files at the top of the zip are renamed into place, taking
+// the place of the ones from an earlier extraction. It returns the paths it
+// created, in zip order.
+func (l Limits) Extract(src, destination string, report progress.Func) ([]string, error) {
+	r, err := zip.OpenReader(src)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	name := filepath.Base(src)
+	if l.Files > 0 && len(r.File) > l.Files {
+		return nil, fmt.Errorf("%s holds %d files, more than the %d allowed", name, len(r.File), l.Files)
+	}
+	var total uint64
+	for _, f := range r.File {
+		mode := f.Mode()
+		if !mode.IsDir() && !mode.IsRegular() {
+			return nil, fmt.Errorf("%s: %s is not a regular file (%s)", name, f.Name, mode)
+		}
+		if l.Ratio > 0 && f.UncompressedSize64 > 1<<20 && f.UncompressedSize64/l.Ratio > f.CompressedSize64 {
+			return nil, fmt.Errorf("%s: %s expands more than %d times", name, f.Name, l.Ratio)
+		}
+		total += f.UncompressedSize64
+	}
+	if l.Size > 0 && total > l.Size {
+		return nil, fmt.Errorf("%s expands to %d bytes, more than the %d allowed", name, total, l.Size)
+	}
+	if err := disk.Check(destination, total); err != nil {
+		return nil, fmt.Errorf("cannot extract %s: %w", name, err)
+	}
+
+	if err := os.MkdirAll(destination, 0755); err != nil {
+		return nil, err
+	}
+	tmp, err := ioutil.TempDir(destination, ".extract-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmp)
+	report.Report(progress.Event{Op: progress.Extract, File: src, Total: total})
+	counter := &extractCounter{file: src, total: total, report: report}
+	var filenames, tops []string
+	for _, f := range r.File {
+		fpath := filepath.Join(tmp, f.Name)
+		if !strings.HasPrefix(fpath, filepath.Clean(tmp)+string(os.PathSeparator)) {
+			return nil, fmt.Errorf("%s is an illegal filepath", f.Name)
+		}
+		rel, _ := filepath.Rel(tmp, fpath)
+		filenames = append(filenames, filepath.Join(destination, rel))
+		if top := strings.SplitN(rel, string(os.PathSeparator), 2)[0]; !contains(tops, top) {
+			tops = append(tops, top)
+		}
+		if f.FileInfo().IsDir() {
+			if err := os.MkdirAll(fpath, 0755); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(fpath), 0755); err != nil {
+			return nil, err
+		}
+		perm := os.FileMode(0644)
+		if f.Mode()&0111 != 0 || strings.HasSuffix(f.Name, ".sh") {
+			perm = 0755
+		}
+		if err := extractFile(f, fpath, perm, counter); err != nil {
+			return nil, fmt.Errorf("%s: %w", f.Name, err)
+		}
+		if l.Size > 0 && counter.written > l.Size {
+			return nil, fmt.Errorf("%s expands to more than the %d bytes allowed", name, l.Size)
+		}
+	}
+
+	// Files from an earlier extraction are moved aside, then removed with their folder
+	replaced, err := ioutil.TempDir(destination, ".replaced-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(replaced)
+	for _, top := range tops {
+		target := filepath.Join(destination, top)
+		if _, err := os.Lstat(target); err == nil {
+			if err := os.Rename(target, filepath.Join(replaced, top)); err != nil {
+				return nil, err
+			}
+		}
+		if err := os.Rename(filepath.Join(tmp, top), target); err != nil {
+			return nil, err
+		}
+	}
+	report.Report(progress.Event{Op: progress.Extract, File: src, Current: counter.written, Total: total, Done: true})
+	return filenames, nil
+}
+
+func extractFile(f *zip.File, path string, perm os.FileMode, counter *extractCounter) error {
+	out, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+	if err != nil {
+		return err
+	}
+	rc, err := f.Open()
+	if err != nil {
+		out.Close()
+		return err
+	}
+	// The zip reader fails on files larger than they claim to be
+	_, err = io.Copy(out, io.TeeReader(rc, counter))
+	rc.Close()
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// extractCounter reports the bytes written while extracting file, every MiB.
+type extractCounter struct {
+	file     string
+	written  uint64
+	reported uint64
+	total    uint64
+	report   progress.Func
+}
+
+func (c *extractCounter) Write(p []byte) (int, error) {
+	c.written += uint64(len(p))
+	if c.written-c.reported >= 1<<20 {
+		c.reported = c.written
+		c.report.Report(progress.Event{Op: progress.Extract, File: c.file, Current: c.written, Total: c.total})
+	}
+	return len(p), nil
+}
+
+// Size returns the bytes src expands to, as its directory records them.
+func Size(src string) (uint64, error) {
+	r, err := zip.OpenReader(src)
+	if err != nil {
+		return 0, err
+	}
+	defer r.Close()
+	var total uint64
+	for _, f := range r.File {
+		total += f.UncompressedSize64
+	}
+	return total, nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// Verify checks the SHA-256 sum of file against the hex encoded sha256sum.
+func Verify(file, sha256sum string) error {
+	sum, err := SHA256(file)
+	if err != nil {
+		return err
+	}
+	if sha256sum == sum {
+		return nil
+	}
+	return errors.New("sha256sum mismatch")
+}
+
+// SHA256 returns the hex encoded SHA-256 sum of file.
+func SHA256(file string) (string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// Check reads every file in the zip src, failing on the first one whose
+// contents do not match their CRC-32.
+func Check(src string) error {
+	r, err := zip.OpenReader(src)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	for _, f := range r.File {
+		rc, err := f.Open()
+		if err != nil {
+			return fmt.Errorf("%s: %w", f.Name, err)
+		}
+		_, err = io.Copy(ioutil.Discard, rc)
+		rc.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %w", f.Name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,283 @@
+// Copyright 2020 CIS Maxwell, LLC. All rights reserved.
+// Copyright 2020 The Calyx Institute
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package archive
+
+import (
+	"archive/zip"
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// entry is a file or folder of a crafted zip.
+type entry struct {
+	name string
+	mode os.FileMode
+	data []byte
+}
+
+// writeZip writes a zip of entries in dir and returns its path.
+func writeZip(t *testing.T, dir string, entries []entry) string {
+	t.Helper()
+	file := filepath.Join(dir, "test.zip")
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for _, e := range entries {
+		header := &zip.FileHeader{Name: e.name, Method: zip.Deflate}
+		mode := e.mode
+		if mode == 0 {
+			mode = 0644
+		}
+		header.SetMode(mode)
+		f, err := w.CreateHeader(header)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := f.Write(e.data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(file, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+// list returns the paths below dir, relative to it and with forward slashes.
+func list(t *testing.T, dir string) []string {
+	t.Helper()
+	var paths []string
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if path != dir {
+			rel, _ := filepath.Rel(dir, path)
+			paths = append(paths, filepath.ToSlash(rel))
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+func TestExtractRejects(t *testing.T) {
+	tests := []struct {
+		name    string
+		limits  Limits
+		entries []entry
+		err     string
+	}{
+		{
+			name:    "path traversal",
+			entries: []entry{{name: "top/ok.txt"}, {name: "../evil.txt", data: []byte("evil")}},
+			err:     "illegal filepath",
+		},
+		{
+			name:    "nested path traversal",
+			entries: []entry{{name: "top/../../evil.txt", data: []byte("evil")}},
+			err:     "illegal filepath",
+		},
+		{
+			name:    "symlink",
+			entries: []entry{{name: "top/link", mode: os.ModeSymlink | 0777, data: []byte("/etc/passwd")}},
+			err:     "not a regular file",
+		},
+		{
+			name:    "device",
+			entries: []entry{{name: "top/dev", mode: os.ModeDevice | 0644}},
+			err:     "not a regular file",
+		},
+		{
+			name:    "named pipe",
+			entries: []entry{{name: "top/fifo", mode: os.ModeNamedPipe | 0644}},
+			err:     "not a regular file",
+		},
+		{
+			name:    "too many files",
+			limits:  Limits{Files: 2},
+			entries: []entry{{name: "top/a"}, {name: "top/b"}, {name: "top/c"}},
+			err:     "more than the 2 allowed",
+		},
+		{
+			name:    "too large",
+			limits:  Limits{Size: 100},
+			entries: []entry{{name: "top/a", data: make([]byte, 60)}, {name: "top/b", data: make([]byte, 60)}},
+			err:     "more than the 100 allowed",
+		},
+		{
+			name:    "expands too much",
+			limits:  Limits{Ratio: 100},
+			entries: []entry{{name: "top/zeros.img", data: make([]byte, 4<<20)}},
+			err:     "expands more than 100 times",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			src := writeZip(t, dir, test.entries)
+			destination := filepath.Join(dir, "out")
+			// An earlier extraction stays as it was when a zip is refused
+			if err := os.MkdirAll(filepath.Join(destination, "top"), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := ioutil.WriteFile(filepath.Join(destination, "top", "old.txt"), []byte("old"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			_, err := test.limits.Extract(src, destination, nil)
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Fatalf("Extract() = %v, want an error containing %q", err, test.err)
+			}
+			if got, want := list(t, destination), []string{"top", "top/old.txt"}; !equal(got, want) {
+				t.Errorf("destination holds %v, want %v", got, want)
+			}
+			if _, err := os.Lstat(filepath.Join(dir, "evil.txt")); err == nil {
+				t.Error("evil.txt was written outside of the destination")
+			}
+		})
+	}
+}
+
+func TestExtractWithinLimits(t *testing.T) {
+	dir := t.TempDir()
+	// Compressible files of up to a MiB are not held to the ratio
+	src := writeZip(t, dir, []entry{
+		{name: "top/", mode: os.ModeDir | 0700},
+		{name: "top/zeros.img", data: make([]byte, 1<<20)},
+		{name: "top/a.txt", data: []byte("a")},
+	})
+	limits := Limits{Size: 1<<20 + 1, Files: 3, Ratio: 100}
+	if _, err := limits.Extract(src, filepath.Join(dir, "out"), nil); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestExtractPermissions(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("no permission bits on Windows")
+	}
+	dir := t.TempDir()
+	src := writeZip(t, dir, []entry{
+		{name: "top/flash-all.sh", mode: 0600, data: []byte("#!/bin/sh\n")},
+		{name: "top/fastboot", mode: 0700, data: []byte("binary")},
+		{name: "top/android-info.txt", mode: 0600, data: []byte("require board=redfin\n")},
+		{name: "top/setuid", mode: os.ModeSetuid | 0777, data: []byte("binary")},
+		{name: "top/sub/", mode: os.ModeDir | 0700},
+	})
+	destination := filepath.Join(dir, "out")
+	if _, err := Extract(src, destination, nil); err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]os.FileMode{
+		"top/flash-all.sh":     0755,
+		"top/fastboot":         0755,
+		"top/android-info.txt": 0644,
+		"top/setuid":           0755,
+		"top/sub":              os.ModeDir | 0755,
+	} {
+		info, err := os.Lstat(filepath.Join(destination, filepath.FromSlash(name)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Mode() != want {
+			t.Errorf("%s has mode %s, want %s", name, info.Mode(), want)
+		}
+	}
+}
+
+func TestExtractReplaces(t *testing.T) {
+	dir := t.TempDir()
+	destination := filepath.Join(dir, "out")
+	// An earlier extraction of the same top folder, next to files of the user
+	for name, data := range map[string]string{
+		"top/old.txt":      "old",
+		"top/flash-all.sh": "old",
+		"topper/keep.txt":  "keep",
+		"top.txt":          "keep",
+		"other/top/keep":   "keep",
+	} {
+		path := filepath.Join(destination, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	src := writeZip(t, dir, []entry{
+		{name: "top/flash-all.sh", data: []byte("new")},
+		{name: "top/image.zip", data: []byte("new")},
+		{name: "readme.txt", data: []byte("new")},
+	})
+	extracted, err := Extract(src, destination, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		filepath.Join(destination, "top", "flash-all.sh"),
+		filepath.Join(destination, "top", "image.zip"),
+		filepath.Join(destination, "readme.txt"),
+	}
+	if !equal(extracted, want) {
+		t.Errorf("Extract() = %v, want %v", extracted, want)
+	}
+	wantFiles := []string{
+		"other", "other/top", "other/top/keep",
+		"readme.txt",
+		"top", "top.txt", "top/flash-all.sh", "top/image.zip",
+		"topper", "topper/keep.txt",
+	}
+	if got := list(t, destination); !equal(got, wantFiles) {
+		t.Errorf("destination holds %v, want %v", got, wantFiles)
+	}
+	for name, want := range map[string]string{
+		"top/flash-all.sh": "new",
+		"topper/keep.txt":  "keep",
+		"top.txt":          "keep",
+		"other/top/keep":   "keep",
+	} {
+		data, err := ioutil.ReadFile(filepath.Join(destination, filepath.FromSlash(name)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != want {
+			t.Errorf("%s holds %q, want %q", name, data, want)
+		}
+	}
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
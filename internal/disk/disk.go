@@ -0,0 +1,80 @@
+// Copyright 2020 CIS Maxwell, LLC. All rights reserved.
+// Copyright 2020 The Calyx Institute
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package disk checks for free space before files are written.
+package disk
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"gitlab.com/calyxos/device-flasher/internal/humanize"
+)
+
+// ShortError reports that writing Needed bytes into Dir would not fit in the
+// Free bytes left there.
+type ShortError struct {
+	Dir    string
+	Needed uint64
+	Free   uint64
+}
+
+func (e *ShortError) Error() string {
+	short := e.Needed - e.Free
+	return fmt.Sprintf("not enough free space in %s: %s needed, %s free, %d bytes (%s) short",
+		e.Dir, humanize.Bytes(e.Needed), humanize.Bytes(e.Free), short, humanize.Bytes(short))
+}
+
+// Free returns the bytes available to the user in the file system holding
+// path, which need not exist yet.
+func Free(path string) (uint64, error) {
+	dir, err := existing(path)
+	if err != nil {
+		return 0, err
+	}
+	return free(dir)
+}
+
+// Check returns a *ShortError if needed bytes do not fit in the file system
+// holding path.
+func Check(path string, needed uint64) error {
+	available, err := Free(path)
+	if err != nil {
+		return err
+	}
+	if needed > available {
+		return &ShortError{Dir: path, Needed: needed, Free: available}
+	}
+	return nil
+}
+
+// existing returns path or the closest of its parents that exists.
+func existing(path string) (string, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	for {
+		if _, err := os.Stat(path); err == nil {
+			return path, nil
+		}
+		parent := filepath.Dir(path)
+		if parent == path {
+			return path, nil
+		}
+		path = parent
+	}
+}
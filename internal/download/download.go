@@ -0,0 +1,152 @@
+// Copyright 2020 CIS Maxwell, LLC. All rights reserved.
+// Copyright 2020 The Calyx Institute
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package download fetches files over HTTP while reporting progress.
+package download
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"gitlab.com/calyxos/device-flasher/internal/disk"
+	"gitlab.com/calyxos/device-flasher/internal/metrics"
+	"gitlab.com/calyxos/device-flasher/progress"
+)
+
+var (
+	downloadedBytes = metrics.Default.Counter("device_flasher_download_bytes_total",
+		"Bytes downloaded.")
+	downloadDuration = metrics.Default.Histogram("device_flasher_download_duration_seconds",
+		"Time taken by downloads, by result.", []float64{1, 5, 15, 30, 60, 120, 300, 600, 1800}, "result")
+)
+
+// File downloads url to destination. The download goes to destination.part
+// first, renamed into place once complete, so that a failed download never
+// leaves a truncated file under the final name.
+func File(ctx context.Context, url, destination string, report progress.Func) (err error) {
+	started := time.Now()
+	defer func() {
+		result := "success"
+		if err != nil {
+			result = "failure"
+		}
+		downloadDuration.Observe(time.Since(started).Seconds(), result)
+	}()
+	report.Report(progress.Event{Op: progress.Download, File: url})
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: %s", url, resp.Status)
+	}
+
+	if resp.ContentLength > 0 {
+		// A file being replaced stays until the download completes
+		if err := disk.Check(filepath.Dir(destination), uint64(resp.ContentLength)); err != nil {
+			return fmt.Errorf("cannot download %s: %w", filepath.Base(destination), err)
+		}
+	}
+
+	part := destination + ".part"
+	f, err := os.Create(part)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			os.Remove(part)
+		}
+	}()
+
+	counter := &WriteCounter{File: url, Report: report}
+	if resp.ContentLength > 0 {
+		counter.Size = uint64(resp.ContentLength)
+	}
+	_, err = io.Copy(f, io.TeeReader(resp.Body, counter))
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	report.Report(progress.Event{Op: progress.Download, File: url, Current: counter.Total, Total: counter.Size, Done: true})
+	if err != nil {
+		return err
+	}
+	if counter.Size > 0 && counter.Total != counter.Size {
+		return fmt.Errorf("%s: got %d of %d bytes", url, counter.Total, counter.Size)
+	}
+	return os.Rename(part, destination)
+}
+
+// Size returns the Content-Length of url, or 0 if the server does not say.
+func Size(ctx context.Context, url string) (uint64, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, url, nil)
+	if err != nil {
+		return 0, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("%s: %s", url, resp.Status)
+	}
+	if resp.ContentLength < 0 {
+		return 0, nil
+	}
+	return uint64(resp.ContentLength), nil
+}
+
+// Retry downloads url to destination like File, trying again up to retries
+// times, after a longer pause each time, unless ctx is done.
+func Retry(ctx context.Context, retries int, url, destination string, report progress.Func) error {
+	for attempt := 1; ; attempt++ {
+		err := File(ctx, url, destination, report)
+		if err == nil || attempt > retries || ctx.Err() != nil {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Duration(attempt) * 5 * time.Second):
+		}
+	}
+}
+
+// WriteCounter counts the bytes written through it and reports the running total.
+type WriteCounter struct {
+	File   string
+	Total  uint64
+	Size   uint64
+	Report progress.Func
+}
+
+func (wc *WriteCounter) Write(p []byte) (int, error) {
+	n := len(p)
+	wc.Total += uint64(n)
+	downloadedBytes.Add(float64(n))
+	wc.Report.Report(progress.Event{Op: progress.Download, File: wc.File, Current: wc.Total, Total: wc.Size})
+	return n, nil
+}
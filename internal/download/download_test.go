@@ -0,0 +1,89 @@
+// Copyright 2020 CIS Maxwell, LLC. All rights reserved.
+// Copyright 2020 The Calyx Institute
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package download
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFile(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/image.zip":
+			_, _ = rw.Write([]byte("new image"))
+		case "/truncated.zip":
+			// Claims more than it sends, then drops the connection
+			rw.Header().Set("Content-Length", "100")
+			_, _ = rw.Write([]byte("partial"))
+			conn, _, err := rw.(http.Hijacker).Hijack()
+			if err == nil {
+				conn.Close()
+			}
+		default:
+			http.NotFound(rw, r)
+		}
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name string
+		path string
+		// want is what the destination holds afterwards
+		want string
+		err  bool
+	}{
+		{name: "success", path: "/image.zip", want: "new image"},
+		{name: "not found", path: "/missing.zip", want: "old image", err: true},
+		{name: "interrupted", path: "/truncated.zip", want: "old image", err: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			destination := filepath.Join(t.TempDir(), "image.zip")
+			if err := ioutil.WriteFile(destination, []byte("old image"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			err := File(context.Background(), server.URL+test.path, destination, nil)
+			if (err != nil) != test.err {
+				t.Fatalf("File() = %v, want error %v", err, test.err)
+			}
+			data, err := ioutil.ReadFile(destination)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(data) != test.want {
+				t.Errorf("destination holds %q, want %q", data, test.want)
+			}
+			if _, err := os.Stat(destination + ".part"); !os.IsNotExist(err) {
+				t.Errorf("%s.part is left: %v", filepath.Base(destination), err)
+			}
+		})
+	}
+
+	// Nothing is left under the final name of a new file either
+	destination := filepath.Join(t.TempDir(), "new.zip")
+	if err := File(context.Background(), server.URL+"/truncated.zip", destination, nil); err == nil {
+		t.Fatal("File() succeeded for a truncated download")
+	}
+	if _, err := os.Stat(destination); !os.IsNotExist(err) {
+		t.Errorf("%s exists after a failed download: %v", filepath.Base(destination), err)
+	}
+}
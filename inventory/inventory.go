@@ -0,0 +1,289 @@
+// Copyright 2020 CIS Maxwell, LLC. All rights reserved.
+// Copyright 2020 The Calyx Institute
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package inventory keeps a record of every device flashed, as one JSON
+// object per line, for auditing which build went onto which device.
+package inventory
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"gitlab.com/calyxos/device-flasher/device"
+	"gitlab.com/calyxos/device-flasher/flash"
+)
+
+// Record is how flashing a device went.
+type Record struct {
+	Serial               string    `json:"serial"`
+	AssetTag             string    `json:"asset_tag,omitempty"`
+	Codename             string    `json:"codename"`
+	Image                string    `json:"image,omitempty"`
+	ImageSHA256          string    `json:"image_sha256,omitempty"`
+	FlasherVersion       string    `json:"flasher_version"`
+	PlatformToolsVersion string    `json:"platform_tools_version"`
+	Operator             string    `json:"operator,omitempty"`
+	Started              time.Time `json:"started"`
+	Finished             time.Time `json:"finished"`
+	// Result is succeeded, failed or canceled.
+	Result string  `json:"result"`
+	Error  string  `json:"error,omitempty"`
+	Phases []Phase `json:"phases"`
+	// LockState is the state the bootloader was left in as far as the sequence
+	// could tell: locked, unlocked or unknown.
+	LockState string `json:"lock_state"`
+}
+
+// Phase is how a phase of the sequence went: unlock, flash, lock or reboot.
+type Phase struct {
+	Name     string    `json:"name"`
+	Result   string    `json:"result"`
+	Started  time.Time `json:"started"`
+	Finished time.Time `json:"finished"`
+}
+
+const (
+	ResultSucceeded = "succeeded"
+	ResultFailed    = "failed"
+	ResultCanceled  = "canceled"
+)
+
+// Image is a factory zip, along with its SHA-256 sum.
+type Image struct {
+	File   string
+	SHA256 string
+}
+
+// Inventory appends records to the file at Path.
+type Inventory struct {
+	Path string
+	// FlasherVersion, PlatformToolsVersion, Operator and Images fill in new records.
+	FlasherVersion       string
+	PlatformToolsVersion string
+	Operator             string
+	// Images maps codenames to the factory zips being flashed.
+	Images map[string]Image
+
+	mu sync.Mutex
+}
+
+func New(path string) *Inventory {
+	return &Inventory{Path: path, Images: map[string]Image{}}
+}
+
+// Entry is a record being filled in as a device goes through the sequence.
+type Entry struct {
+	inventory *Inventory
+	mu        sync.Mutex
+	Record
+}
+
+// Begin starts the record of d going through the sequence run by f. f must
+// only be used for d, as the entry follows its events by chaining f.Events.
+func (inv *Inventory) Begin(f *flash.Flasher, d *device.Device) *Entry {
+	image := inv.Images[d.Codename]
+	entry := &Entry{inventory: inv, Record: Record{
+		Serial:               d.Serial,
+		Codename:             d.Codename,
+		Image:                image.File,
+		ImageSHA256:          image.SHA256,
+		FlasherVersion:       inv.FlasherVersion,
+		PlatformToolsVersion: inv.PlatformToolsVersion,
+		Operator:             inv.Operator,
+		Started:              time.Now(),
+		Phases:               []Phase{},
+	}}
+	events := f.Events
+	f.Events = func(e flash.Event) {
+		entry.event(e)
+		if events != nil {
+			events(e)
+		}
+	}
+	return entry
+}
+
+// phaseOf names the phase step belongs to.
+func phaseOf(step flash.Step) string {
+	switch step {
+	case flash.StepUnlock, flash.StepUnlockCritical:
+		return "unlock"
+	case flash.StepFlash:
+		return "flash"
+	case flash.StepLock:
+		return "lock"
+	case flash.StepReboot:
+		return "reboot"
+	}
+	return ""
+}
+
+func (entry *Entry) event(e flash.Event) {
+	name := phaseOf(e.Step)
+	if name == "" {
+		return
+	}
+	entry.mu.Lock()
+	defer entry.mu.Unlock()
+	if n := len(entry.Phases); n > 0 && entry.Phases[n-1].Name == name {
+		return
+	}
+	entry.closePhase(ResultSucceeded)
+	entry.Phases = append(entry.Phases, Phase{Name: name, Started: time.Now()})
+}
+
+// closePhase ends the phase in progress, if any.
+func (entry *Entry) closePhase(result string) {
+	if n := len(entry.Phases); n > 0 && entry.Phases[n-1].Result == "" {
+		entry.Phases[n-1].Result, entry.Phases[n-1].Finished = result, time.Now()
+	}
+}
+
+// End completes the record with err, the outcome of the sequence, and adds it
+// to the inventory.
+func (entry *Entry) End(err error) error {
+	entry.mu.Lock()
+	entry.Finished = time.Now()
+	switch {
+	case err == nil:
+		entry.Result = ResultSucceeded
+	case errors.Is(err, context.Canceled):
+		entry.Result, entry.Error = ResultCanceled, err.Error()
+	default:
+		entry.Result, entry.Error = ResultFailed, err.Error()
+	}
+	entry.closePhase(entry.Result)
+	// The sequence only gets past unlocking or locking once the bootloader reports it
+	entry.LockState = "unknown"
+	for _, phase := range entry.Phases {
+		switch {
+		case phase.Name == "unlock" && phase.Result == ResultSucceeded:
+			entry.LockState = "unlocked"
+		case phase.Name == "lock" && phase.Result == ResultSucceeded:
+			entry.LockState = "locked"
+		}
+	}
+	record := entry.Record
+	entry.mu.Unlock()
+	return entry.inventory.Add(record)
+}
+
+// Add appends record to the inventory.
+func (inv *Inventory) Add(record Record) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+	if err := os.MkdirAll(filepath.Dir(inv.Path), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(inv.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Filter selects records. Empty fields match every record.
+type Filter struct {
+	Serial   string
+	AssetTag string
+	Codename string
+	Operator string
+	Result   string
+	// Since and Until bound when the records started.
+	Since time.Time
+	Until time.Time
+}
+
+func (filter Filter) match(r Record) bool {
+	return (filter.Serial == "" || r.Serial == filter.Serial) &&
+		(filter.AssetTag == "" || r.AssetTag == filter.AssetTag) &&
+		(filter.Codename == "" || r.Codename == filter.Codename) &&
+		(filter.Operator == "" || r.Operator == filter.Operator) &&
+		(filter.Result == "" || r.Result == filter.Result) &&
+		(filter.Since.IsZero() || !r.Started.Before(filter.Since)) &&
+		(filter.Until.IsZero() || r.Started.Before(filter.Until))
+}
+
+// Records returns the records matching filter, oldest first. There are none
+// until the first device is recorded.
+func (inv *Inventory) Records(filter Filter) ([]Record, error) {
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+	f, err := os.Open(inv.Path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var records []Record
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for n := 1; scanner.Scan(); n++ {
+		if len(strings.TrimSpace(scanner.Text())) == 0 {
+			continue
+		}
+		var r Record
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			return records, fmt.Errorf("%s:%d: %w", inv.Path, n, err)
+		}
+		if filter.match(r) {
+			records = append(records, r)
+		}
+	}
+	return records, scanner.Err()
+}
+
+// WriteCSV writes records as CSV with a header row. Phases are written as
+// name:result pairs separated by spaces.
+func WriteCSV(w io.Writer, records []Record) error {
+	out := csv.NewWriter(w)
+	_ = out.Write([]string{"serial", "asset_tag", "codename", "image", "image_sha256", "flasher_version", "platform_tools_version",
+		"operator", "started", "finished", "result", "error", "phases", "lock_state"})
+	for _, r := range records {
+		var phases []string
+		for _, phase := range r.Phases {
+			phases = append(phases, phase.Name+":"+phase.Result)
+		}
+		_ = out.Write([]string{r.Serial, r.AssetTag, r.Codename, r.Image, r.ImageSHA256, r.FlasherVersion, r.PlatformToolsVersion,
+			r.Operator, r.Started.Format(time.RFC3339), r.Finished.Format(time.RFC3339), r.Result, r.Error,
+			strings.Join(phases, " "), r.LockState})
+	}
+	out.Flush()
+	return out.Error()
+}
@@ -0,0 +1,112 @@
+// Copyright 2020 CIS Maxwell, LLC. All rights reserved.
+// Copyright 2020 The Calyx Institute
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package parse
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Device is one line of adb devices -l or fastboot devices -l.
+type Device struct {
+	Serial string
+	// State is device, recovery, sideload, unauthorized, offline, fastboot and so on.
+	State string
+	// Attrs holds the key:value pairs that follow the state, such as
+	// usb, product, model, device and transport_id.
+	Attrs map[string]string
+}
+
+var attr = regexp.MustCompile(`^[a-z_]+:\S*$`)
+
+// ADBDevices parses the output of adb devices, with or without -l.
+//
+//	$ adb devices -l
+//	* daemon not running; starting now at tcp:5037
+//	* daemon started successfully
+//	List of devices attached
+//	0A091FDD4002S4         device usb:1-1 product:redfin model:Pixel_5 device:redfin transport_id:1
+//	R58M12345              unauthorized usb:1-2 transport_id:3
+//	0123456789ABCDEF       no permissions (user in plugdev group; are your udev rules wrong?); see [http://developer.android.com/tools/device.html] usb:1-3 transport_id:4
+func ADBDevices(out []byte) ([]Device, error) {
+	var devices []Device
+	header := false
+	for _, line := range strings.Split(string(out), "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "" || strings.HasPrefix(line, "* "):
+			continue
+		case line == "List of devices attached":
+			header = true
+			continue
+		}
+		if !header {
+			return nil, fmt.Errorf("adb devices: unexpected line %q", line)
+		}
+		d, err := parseDevice(line)
+		if err != nil {
+			return nil, fmt.Errorf("adb devices: %w", err)
+		}
+		devices = append(devices, d)
+	}
+	return devices, nil
+}
+
+// FastbootDevices parses the output of fastboot devices, with or without -l.
+//
+//	$ fastboot devices -l
+//	0A091FDD4002S4         fastboot usb:1-1
+func FastbootDevices(out []byte) ([]Device, error) {
+	var devices []Device
+	for _, line := range strings.Split(string(out), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "< waiting") {
+			continue
+		}
+		d, err := parseDevice(line)
+		if err != nil {
+			return nil, fmt.Errorf("fastboot devices: %w", err)
+		}
+		devices = append(devices, d)
+	}
+	return devices, nil
+}
+
+func parseDevice(line string) (Device, error) {
+	fields := strings.Fields(line)
+	if len(fields) < 2 {
+		return Device{}, fmt.Errorf("no state in %q", line)
+	}
+	d := Device{Serial: fields[0], Attrs: map[string]string{}}
+	i := 1
+	var state []string
+	for ; i < len(fields) && !attr.MatchString(fields[i]); i++ {
+		state = append(state, fields[i])
+	}
+	d.State = strings.Join(state, " ")
+	for ; i < len(fields); i++ {
+		kv := strings.SplitN(fields[i], ":", 2)
+		if len(kv) != 2 {
+			return Device{}, fmt.Errorf("unexpected %q in %q", fields[i], line)
+		}
+		d.Attrs[kv[0]] = kv[1]
+	}
+	if d.State == "" {
+		return Device{}, fmt.Errorf("no state in %q", line)
+	}
+	return d, nil
+}
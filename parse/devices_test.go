@@ -0,0 +1,129 @@
+// Copyright 2020 CIS Maxwell, LLC. All rights reserved.
+// Copyright 2020 The Calyx Institute
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package parse
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestADBDevices(t *testing.T) {
+	tests := []struct {
+		name    string
+		out     string
+		devices []Device
+		err     bool
+	}{
+		{
+			name: "none",
+			out:  "List of devices attached\n\n",
+		},
+		{
+			name: "daemon start",
+			out: "* daemon not running; starting now at tcp:5037\n" +
+				"* daemon started successfully\n" +
+				"List of devices attached\n" +
+				"0A091FDD4002S4         device usb:1-1 product:redfin model:Pixel_5 device:redfin transport_id:1\n\n",
+			devices: []Device{{Serial: "0A091FDD4002S4", State: "device", Attrs: map[string]string{
+				"usb": "1-1", "product": "redfin", "model": "Pixel_5", "device": "redfin", "transport_id": "1"}}},
+		},
+		{
+			name: "unauthorized",
+			out: "List of devices attached\n" +
+				"0A091FDD4002S4         unauthorized usb:1-1 transport_id:2\n",
+			devices: []Device{{Serial: "0A091FDD4002S4", State: "unauthorized", Attrs: map[string]string{
+				"usb": "1-1", "transport_id": "2"}}},
+		},
+		{
+			name: "no permissions",
+			out: "List of devices attached\r\n" +
+				"0A091FDD4002S4         no permissions (missing udev rules? user is in the plugdev group); see [http://developer.android.com/tools/device.html] usb:1-1 transport_id:3\r\n",
+			devices: []Device{{Serial: "0A091FDD4002S4",
+				State: "no permissions (missing udev rules? user is in the plugdev group); see [http://developer.android.com/tools/device.html]",
+				Attrs: map[string]string{"usb": "1-1", "transport_id": "3"}}},
+		},
+		{
+			name: "sideload and recovery",
+			out: "List of devices attached\n" +
+				"0A091FDD4002S4\tsideload\n" +
+				"FP5A0012345\trecovery\n",
+			devices: []Device{
+				{Serial: "0A091FDD4002S4", State: "sideload", Attrs: map[string]string{}},
+				{Serial: "FP5A0012345", State: "recovery", Attrs: map[string]string{}},
+			},
+		},
+		{
+			name: "no header",
+			out:  "adb: failed to check server version: cannot connect to daemon\n",
+			err:  true,
+		},
+		{
+			name: "no state",
+			out:  "List of devices attached\n0A091FDD4002S4\n",
+			err:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			devices, err := ADBDevices([]byte(tt.out))
+			if (err != nil) != tt.err {
+				t.Fatalf("error %v, expected one: %v", err, tt.err)
+			}
+			if !reflect.DeepEqual(devices, tt.devices) {
+				t.Errorf("devices %+v, expected %+v", devices, tt.devices)
+			}
+		})
+	}
+}
+
+func TestFastbootDevices(t *testing.T) {
+	tests := []struct {
+		name    string
+		out     string
+		devices []Device
+	}{
+		{
+			name: "fastboot",
+			out:  "0A091FDD4002S4\tfastboot\nFP5A0012345\tfastboot\n",
+			devices: []Device{
+				{Serial: "0A091FDD4002S4", State: "fastboot", Attrs: map[string]string{}},
+				{Serial: "FP5A0012345", State: "fastboot", Attrs: map[string]string{}},
+			},
+		},
+		{
+			name: "no permissions",
+			out:  "no_permissions\tno permissions (missing udev rules? user is in the plugdev group); see [http://developer.android.com/tools/device.html]\n",
+			devices: []Device{{Serial: "no_permissions",
+				State: "no permissions (missing udev rules? user is in the plugdev group); see [http://developer.android.com/tools/device.html]",
+				Attrs: map[string]string{}}},
+		},
+		{
+			name: "waiting",
+			out:  "< waiting for any device >\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			devices, err := FastbootDevices([]byte(tt.out))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(devices, tt.devices) {
+				t.Errorf("devices %+v, expected %+v", devices, tt.devices)
+			}
+		})
+	}
+}
@@ -0,0 +1,195 @@
+// Copyright 2020 CIS Maxwell, LLC. All rights reserved.
+// Copyright 2020 The Calyx Institute
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package parse reads the output of adb and fastboot into typed results.
+package parse
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// FailError is a FAIL response from the bootloader or an error from the fastboot client.
+type FailError struct {
+	Reason string
+}
+
+func (e *FailError) Error() string {
+	return "fastboot: " + e.Reason
+}
+
+// FastbootResponse is the parsed output of one fastboot command.
+type FastbootResponse struct {
+	// Vars holds the key: value lines, with multi-line values joined.
+	Vars map[string]string
+	// Keys holds the keys of Vars in the order they were printed.
+	Keys []string
+	// Info holds the INFO messages that are not key: value pairs.
+	Info []string
+	// Okay is set when the bootloader answered OKAY.
+	Okay bool
+	// Text holds the remaining lines printed by the fastboot client.
+	Text []string
+}
+
+// Var returns the value printed for key. Keys are matched exactly, so
+// "unlocked" does not match "Device critical unlocked".
+func (r *FastbootResponse) Var(key string) (string, error) {
+	if value, ok := r.Vars[key]; ok {
+		return value, nil
+	}
+	return "", fmt.Errorf("fastboot: no value for %s", key)
+}
+
+var (
+	// (bootloader) ro.build.fingerprint[1]: ...
+	indexedKey = regexp.MustCompile(`^(.+)\[(\d+)\]$`)
+	// product: redfin
+	plainKey = regexp.MustCompile(`^[A-Za-z0-9_.\-]+(\[\d+\])?$`)
+	// OKAY [  0.000s]
+	okay = regexp.MustCompile(`(^|\s)OKAY(\s*\[.*\])?$`)
+	// FAILED (remote: 'Flashing Lock is not allowed')
+	failed = regexp.MustCompile(`FAILED \((?:remote: )?'?(.*?)'?\)$`)
+)
+
+// Fastboot parses what a fastboot command printed to stdout and stderr.
+//
+//	$ fastboot getvar product
+//	product: redfin
+//	Finished. Total time: 0.002s
+//
+//	$ fastboot flashing get_unlock_ability
+//	(bootloader) get_unlock_ability: 0
+//	OKAY [  0.000s]
+//	Finished. Total time: 0.000s
+//
+//	$ fastboot oem device-info
+//	(bootloader) Verity mode: false
+//	(bootloader) Device unlocked: true
+//	(bootloader) Device critical unlocked: true
+//	(bootloader) Charger screen enabled: false
+//	OKAY [  0.000s]
+//	Finished. Total time: 0.000s
+//
+//	$ fastboot getvar all
+//	(bootloader) max-download-size:0x10000000
+//	(bootloader) partition-size:abl_a:0x800000
+//	(bootloader) ro.build.fingerprint[0]: motorola/devon_g/devon:12/S1RM
+//	(bootloader) ro.build.fingerprint[1]: 32.63-15-2/88b09:user/release-keys
+//	all:
+//	Finished. Total time: 0.142s
+//
+//	$ fastboot flashing lock
+//	FAILED (remote: 'Flashing Lock is not allowed')
+//	fastboot: error: Command failed
+//
+// Raw protocol responses (OKAY, FAIL<reason>, INFO<message>) are understood as
+// well. A FAIL is returned as a *FailError, along with everything parsed.
+func Fastboot(out []byte) (*FastbootResponse, error) {
+	r := &FastbootResponse{Vars: map[string]string{}}
+	parts := map[string][]string{}
+	var fail error
+	for _, line := range strings.Split(string(out), "\n") {
+		line = strings.TrimRight(line, "\r")
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		switch {
+		case strings.HasPrefix(line, "(bootloader) "):
+			message := strings.TrimPrefix(line, "(bootloader) ")
+			if key, value, ok := splitVar(message, false); ok {
+				r.addVar(parts, key, value)
+			} else {
+				r.Info = append(r.Info, message)
+			}
+		case strings.HasPrefix(line, "INFO"):
+			r.Info = append(r.Info, strings.TrimPrefix(line, "INFO"))
+		case strings.HasPrefix(line, "FAIL") && !strings.HasPrefix(line, "FAILED"):
+			fail = &FailError{Reason: strings.TrimPrefix(line, "FAIL")}
+		case failed.MatchString(line):
+			fail = &FailError{Reason: failed.FindStringSubmatch(line)[1]}
+		case strings.HasPrefix(line, "fastboot: error: "):
+			if fail == nil {
+				fail = &FailError{Reason: strings.TrimPrefix(line, "fastboot: error: ")}
+			}
+		case okay.MatchString(line):
+			r.Okay = true
+			r.Text = append(r.Text, line)
+		default:
+			if key, value, ok := splitVar(line, true); ok {
+				if key != "all" {
+					r.addVar(parts, key, value)
+				}
+			} else {
+				r.Text = append(r.Text, line)
+			}
+		}
+	}
+	for key, values := range parts {
+		r.Vars[key] = strings.Join(values, "")
+	}
+	return r, fail
+}
+
+func (r *FastbootResponse) addVar(parts map[string][]string, key, value string) {
+	index := 0
+	if m := indexedKey.FindStringSubmatch(key); m != nil {
+		key = m[1]
+		index, _ = strconv.Atoi(m[2])
+	}
+	if _, exists := parts[key]; !exists {
+		r.Keys = append(r.Keys, key)
+	}
+	for len(parts[key]) <= index {
+		parts[key] = append(parts[key], "")
+	}
+	parts[key][index] = value
+}
+
+// splitVar splits "key: value" or "key:value". getvar all prints
+// partition-size:abl_a:0x800000, so without a ": " the value follows the last
+// colon, unless that would put a slash in the key: values such as
+// ro.build.fingerprint[0]:google/redfin/redfin:11/... hold colons too. Lines
+// printed by the fastboot client itself only count as variables when the key
+// is a plain identifier.
+func splitVar(line string, plain bool) (string, string, bool) {
+	var key, value string
+	if i := strings.Index(line, ": "); i >= 0 {
+		key, value = line[:i], line[i+2:]
+	} else if i := strings.LastIndex(line, ":"); i >= 0 {
+		for strings.Contains(line[:i], "/") {
+			if i = strings.LastIndex(line[:i], ":"); i < 0 {
+				return "", "", false
+			}
+		}
+		key, value = line[:i], line[i+1:]
+	} else {
+		return "", "", false
+	}
+	key = strings.TrimSpace(key)
+	if key == "" || (plain && !plainKey.MatchString(key)) {
+		return "", "", false
+	}
+	return key, strings.TrimSpace(value), true
+}
+
+// IsFail reports whether err is a FAIL from fastboot.
+func IsFail(err error) bool {
+	var failErr *FailError
+	return errors.As(err, &failErr)
+}
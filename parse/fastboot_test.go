@@ -0,0 +1,173 @@
+// Copyright 2020 CIS Maxwell, LLC. All rights reserved.
+// Copyright 2020 The Calyx Institute
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package parse
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFastboot(t *testing.T) {
+	tests := []struct {
+		name string
+		out  string
+		// vars are checked one by one, so that unrelated keys need not be listed
+		vars map[string]string
+		keys []string
+		info []string
+		okay bool
+		fail string
+	}{
+		{
+			name: "getvar",
+			out:  "product: redfin\nFinished. Total time: 0.002s\n",
+			vars: map[string]string{"product": "redfin"},
+			keys: []string{"product"},
+		},
+		{
+			name: "getvar with CRLF",
+			out:  "unlocked: yes\r\nFinished. Total time: 0.001s\r\n",
+			vars: map[string]string{"unlocked": "yes"},
+			keys: []string{"unlocked"},
+		},
+		{
+			name: "getvar all",
+			out: "(bootloader) version-bootloader:r3-0.4-8741924\n" +
+				"(bootloader) product:redfin\n" +
+				"(bootloader) serialno:0A091FDD4002S4\n" +
+				"(bootloader) ro.build.fingerprint[0]:google/redfin/redfin:11/RQ3A.2\n" +
+				"(bootloader) ro.build.fingerprint[1]:10605.001/7005896:user/release-keys\n" +
+				"(bootloader) unlocked:no\n" +
+				"(bootloader) partition-size:abl_a:0x800000\n" +
+				"(bootloader) has-slot:boot:yes\n" +
+				"all: \n" +
+				"Finished. Total time: 0.053s\n",
+			vars: map[string]string{
+				"version-bootloader":   "r3-0.4-8741924",
+				"product":              "redfin",
+				"serialno":             "0A091FDD4002S4",
+				"ro.build.fingerprint": "google/redfin/redfin:11/RQ3A.210605.001/7005896:user/release-keys",
+				"unlocked":             "no",
+				"partition-size:abl_a": "0x800000",
+				"has-slot:boot":        "yes",
+			},
+			keys: []string{"version-bootloader", "product", "serialno", "ro.build.fingerprint", "unlocked", "partition-size:abl_a", "has-slot:boot"},
+		},
+		{
+			name: "get_unlock_ability",
+			out:  "(bootloader) get_unlock_ability: 1\nOKAY [  0.000s]\nFinished. Total time: 0.000s\n",
+			vars: map[string]string{"get_unlock_ability": "1"},
+			keys: []string{"get_unlock_ability"},
+			okay: true,
+		},
+		{
+			name: "oem device-info",
+			out: "(bootloader) Verity mode: false\n" +
+				"(bootloader) Device unlocked: true\n" +
+				"(bootloader) Device critical unlocked: false\n" +
+				"(bootloader) Charger screen enabled: false\n" +
+				"OKAY [  0.000s]\n" +
+				"Finished. Total time: 0.000s\n",
+			vars: map[string]string{
+				"Device unlocked":          "true",
+				"Device critical unlocked": "false",
+			},
+			keys: []string{"Verity mode", "Device unlocked", "Device critical unlocked", "Charger screen enabled"},
+			okay: true,
+		},
+		{
+			name: "FAILED",
+			out:  "FAILED (remote: 'Flashing Lock is not allowed')\nfastboot: error: Command failed\n",
+			fail: "Flashing Lock is not allowed",
+		},
+		{
+			name: "FAILED without remote",
+			out:  "FAILED (Write to device failed (no link))\nfastboot: error: Command failed\n",
+			fail: "Write to device failed (no link)",
+		},
+		{
+			name: "FAIL",
+			out:  "FAILunknown command\n",
+			fail: "unknown command",
+		},
+		{
+			name: "error only",
+			out:  "fastboot: error: Device does not exist\n",
+			fail: "Device does not exist",
+		},
+		{
+			name: "INFO",
+			out:  "INFOerasing userdata\nINFOdone\nOKAY [  1.204s]\nFinished. Total time: 1.204s\n",
+			info: []string{"erasing userdata", "done"},
+			okay: true,
+		},
+		{
+			name: "bootloader messages",
+			out:  "(bootloader) Unlocking device\nOKAY [  0.031s]\n",
+			info: []string{"Unlocking device"},
+			okay: true,
+		},
+		{
+			name: "OKAY alone",
+			out:  "Sending 'boot_a' (98304 KB)                       OKAY [  2.467s]\nFinished. Total time: 2.500s\n",
+			okay: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := Fastboot([]byte(tt.out))
+			switch {
+			case tt.fail == "" && err != nil:
+				t.Fatalf("unexpected error %v", err)
+			case tt.fail != "" && !IsFail(err):
+				t.Fatalf("expected a FailError, got %v", err)
+			case tt.fail != "" && err.(*FailError).Reason != tt.fail:
+				t.Fatalf("reason %q, expected %q", err.(*FailError).Reason, tt.fail)
+			}
+			for key, expected := range tt.vars {
+				if value, err := r.Var(key); err != nil || value != expected {
+					t.Errorf("%s = %q (%v), expected %q", key, value, err, expected)
+				}
+			}
+			if len(r.Keys) != len(tt.keys) || (len(tt.keys) > 0 && !reflect.DeepEqual(r.Keys, tt.keys)) {
+				t.Errorf("keys %q, expected %q", r.Keys, tt.keys)
+			}
+			if len(r.Info) != len(tt.info) || (len(tt.info) > 0 && !reflect.DeepEqual(r.Info, tt.info)) {
+				t.Errorf("info %q, expected %q", r.Info, tt.info)
+			}
+			if r.Okay != tt.okay {
+				t.Errorf("okay %v, expected %v", r.Okay, tt.okay)
+			}
+		})
+	}
+}
+
+func TestFastbootCriticalUnlocked(t *testing.T) {
+	// "Device unlocked" must not be read as the critical state, nor the other way round
+	r, err := Fastboot([]byte("(bootloader) Device unlocked: false\n(bootloader) Device critical unlocked: true\nOKAY [  0.000s]\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := r.Var("Device unlocked"); v != "false" {
+		t.Errorf("Device unlocked = %q", v)
+	}
+	if v, _ := r.Var("Device critical unlocked"); v != "true" {
+		t.Errorf("Device critical unlocked = %q", v)
+	}
+	if _, err := r.Var("unlocked"); err == nil {
+		t.Error("unlocked should not be set by oem device-info")
+	}
+}
@@ -0,0 +1,208 @@
+// Copyright 2020 CIS Maxwell, LLC. All rights reserved.
+// Copyright 2020 The Calyx Institute
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package platformtools fetches the Android SDK platform tools (adb and fastboot).
+package platformtools
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+
+	"gitlab.com/calyxos/device-flasher/cache"
+	"gitlab.com/calyxos/device-flasher/command"
+	"gitlab.com/calyxos/device-flasher/internal/archive"
+	"gitlab.com/calyxos/device-flasher/internal/download"
+	"gitlab.com/calyxos/device-flasher/progress"
+)
+
+// Version is the platform tools release used unless told otherwise.
+const Version = "33.0.3"
+
+var urls = map[[2]string]string{
+	[2]string{"darwin", "33.0.3"}:  "https://dl.google.com/android/repository/platform-tools_r33.0.3-darwin.zip",
+	[2]string{"linux", "33.0.3"}:   "https://dl.google.com/android/repository/platform-tools_r33.0.3-linux.zip",
+	[2]string{"windows", "33.0.3"}: "https://dl.google.com/android/repository/platform-tools_r33.0.3-windows.zip",
+}
+
+var checksums = map[[2]string]string{
+	[2]string{"darwin", "33.0.3"}:  "84acbbd2b2ccef159ae3e6f83137e44ad18388ff3cc66bb057c87d761744e595",
+	[2]string{"linux", "33.0.3"}:   "ab885c20f1a9cb528eb145b9208f53540efa3d26258ac3ce4363570a0846f8f7",
+	[2]string{"windows", "33.0.3"}: "1e59afd40a74c5c0eab0a9fad3f0faf8a674267106e0b19921be9f67081808c2",
+}
+
+// PlatformTools is a copy of the platform tools extracted into Dir.
+type PlatformTools struct {
+	// Dir receives the platform-tools folder
+	Dir string
+	// ZipDir receives the platform tools zip, Dir if empty
+	ZipDir  string
+	OS      string
+	Version string
+	// Progress receives download, verification and extraction progress
+	Progress progress.Func
+	// Runner stops running platform tools before they are overwritten
+	Runner command.Runner
+	// Mirror, if set, is downloaded from in place of Google, with the same checksums
+	Mirror string
+	// Retries is how many more times a failed download is tried
+	Retries int
+	// Cache, if set, keeps the extracted platform tools, and Get points Dir at them
+	Cache *cache.Cache
+	// Offline makes Download fail rather than download a missing zip
+	Offline bool
+}
+
+// New returns the platform tools for the running OS, to be extracted into dir.
+func New(dir string, report progress.Func) *PlatformTools {
+	return &PlatformTools{
+		Dir:      dir,
+		OS:       runtime.GOOS,
+		Version:  Version,
+		Progress: report,
+		Runner:   command.Exec{},
+	}
+}
+
+// OSes returns the operating systems the platform tools of version are available for.
+func OSes(version string) []string {
+	var oses []string
+	for key := range urls {
+		if key[1] == version {
+			oses = append(oses, key[0])
+		}
+	}
+	sort.Strings(oses)
+	return oses
+}
+
+// URL returns where the platform tools zip is downloaded from.
+func (p *PlatformTools) URL() (string, error) {
+	url, ok := urls[[2]string{p.OS, p.Version}]
+	if !ok {
+		return "", fmt.Errorf("no platform tools %s available for %s", p.Version, p.OS)
+	}
+	if p.Mirror != "" {
+		return strings.TrimSuffix(p.Mirror, "/") + "/" + path.Base(url), nil
+	}
+	return url, nil
+}
+
+// Path returns the folder holding adb and fastboot.
+func (p *PlatformTools) Path() string {
+	return filepath.Join(p.Dir, "platform-tools")
+}
+
+func (p *PlatformTools) ADB() string {
+	return p.executable("adb")
+}
+
+func (p *PlatformTools) Fastboot() string {
+	return p.executable("fastboot")
+}
+
+func (p *PlatformTools) executable(name string) string {
+	if p.OS == "windows" {
+		name += ".exe"
+	}
+	return filepath.Join(p.Path(), name)
+}
+
+// Zip returns the path of the platform tools zip.
+func (p *PlatformTools) Zip() (string, error) {
+	url, err := p.URL()
+	if err != nil {
+		return "", err
+	}
+	dir := p.ZipDir
+	if dir == "" {
+		dir = p.Dir
+	}
+	return filepath.Join(dir, path.Base(url)), nil
+}
+
+// Download downloads the platform tools zip unless it is already present and verifies it.
+func (p *PlatformTools) Download(ctx context.Context) error {
+	url, err := p.URL()
+	if err != nil {
+		return err
+	}
+	platformToolsZip, _ := p.Zip()
+	_, err = os.Stat(platformToolsZip)
+	if err != nil && p.Offline {
+		return fmt.Errorf("%s is missing and cannot be downloaded offline", filepath.Base(platformToolsZip))
+	}
+	if err != nil {
+		if err := os.MkdirAll(filepath.Dir(platformToolsZip), 0755); err != nil {
+			return err
+		}
+		err = download.Retry(ctx, p.Retries, url, platformToolsZip, p.Progress)
+		if err != nil {
+			return err
+		}
+	}
+	return p.Verify()
+}
+
+// Verify checks the platform tools zip against its known checksum.
+func (p *PlatformTools) Verify() error {
+	platformToolsZip, err := p.Zip()
+	if err != nil {
+		return err
+	}
+	p.Progress.Report(progress.Event{Op: progress.Verify, File: platformToolsZip})
+	err = archive.Verify(platformToolsZip, checksums[[2]string{p.OS, p.Version}])
+	p.Progress.Report(progress.Event{Op: progress.Verify, File: platformToolsZip, Done: true})
+	if err != nil {
+		return fmt.Errorf("%s checksum verification failed: %w", filepath.Base(platformToolsZip), err)
+	}
+	return nil
+}
+
+// Get downloads and verifies the platform tools, then extracts them, stopping
+// any running platform tools first. Extractions kept in Cache are reused.
+func (p *PlatformTools) Get(ctx context.Context) error {
+	if err := p.Download(ctx); err != nil {
+		return err
+	}
+	platformToolsZip, _ := p.Zip()
+	// Ensure that no platform tools are running before attempting to overwrite them
+	p.Kill(ctx)
+	if p.Cache != nil {
+		dir, err := p.Cache.Extract(platformToolsZip, p.Progress)
+		if err != nil {
+			return err
+		}
+		p.Dir = dir
+		return nil
+	}
+	_, err := archive.Extract(platformToolsZip, p.Dir, p.Progress)
+	return err
+}
+
+// Kill stops the adb server and, on Windows, any fastboot still holding the binaries open.
+func (p *PlatformTools) Kill(ctx context.Context) {
+	if _, err := os.Stat(p.ADB()); err == nil {
+		_, _ = p.Runner.Run(ctx, command.Cmd{Argv: []string{p.ADB(), "kill-server"}})
+	}
+	if runtime.GOOS == "windows" {
+		_, _ = p.Runner.Run(ctx, command.Cmd{Argv: []string{"taskkill", "/IM", "fastboot.exe", "/F"}})
+	}
+}
@@ -0,0 +1,48 @@
+// Copyright 2020 CIS Maxwell, LLC. All rights reserved.
+// Copyright 2020 The Calyx Institute
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package progress reports how long running file operations advance, leaving
+// it to the caller to display it.
+package progress
+
+// Op is a file operation.
+type Op string
+
+const (
+	Download Op = "download"
+	Verify   Op = "verify"
+	Extract  Op = "extract"
+	Archive  Op = "archive"
+)
+
+// Event reports that Op on File has reached Current of Total bytes.
+// The first event of an operation has Current 0, the last one has Done set.
+// Total is 0 when unknown.
+type Event struct {
+	Op      Op
+	File    string
+	Current uint64
+	Total   uint64
+	Done    bool
+}
+
+// Func receives progress events. A nil Func ignores them.
+type Func func(Event)
+
+func (f Func) Report(e Event) {
+	if f != nil {
+		f(e)
+	}
+}
@@ -0,0 +1,598 @@
+// Copyright 2020 CIS Maxwell, LLC. All rights reserved.
+// Copyright 2020 The Calyx Institute
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package station flashes devices on demand as they get attached, for flashing
+// stations run from a dashboard or driven remotely instead of from the console.
+package station
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"gitlab.com/calyxos/device-flasher/device"
+	"gitlab.com/calyxos/device-flasher/factory"
+	"gitlab.com/calyxos/device-flasher/flash"
+	"gitlab.com/calyxos/device-flasher/internal/metrics"
+	"gitlab.com/calyxos/device-flasher/inventory"
+)
+
+// State is where a job is at.
+type State string
+
+const (
+	Running   State = "running"
+	Succeeded State = "succeeded"
+	Failed    State = "failed"
+	Canceled  State = "canceled"
+)
+
+var (
+	flashedDevices = metrics.Default.Counter("device_flasher_devices_flashed_total",
+		"Devices that went through a job, by codename and result.", "codename", "result")
+	phaseDuration = metrics.Default.Histogram("device_flasher_phase_duration_seconds",
+		"Time taken by the phases of jobs: waiting for unlocking, flashing and waiting for locking.",
+		[]float64{5, 15, 30, 60, 120, 300, 600, 1200, 1800, 3600}, "phase")
+	attachedDevices = metrics.Default.Gauge("device_flasher_attached_devices",
+		"Devices attached when they were last listed.")
+	failures = metrics.Default.Counter("device_flasher_failures_total",
+		"Failed jobs, by what failed.", "category")
+)
+
+// Job is a device going through the flashing sequence.
+type Job struct {
+	ID      string         `json:"id"`
+	Device  *device.Device `json:"device"`
+	Options Options        `json:"options"`
+	// AssetTag is the tag the device had when the job started.
+	AssetTag string `json:"asset_tag,omitempty"`
+	State    State  `json:"state"`
+	// Step, Actions, Partition, Current, Total and Percent follow the events of the sequence.
+	// Actions holds what the operator has to do on the device, if it waits on them.
+	Step      flash.Step     `json:"step,omitempty"`
+	Actions   []flash.Action `json:"actions,omitempty"`
+	Partition string         `json:"partition,omitempty"`
+	Current   int            `json:"current,omitempty"`
+	Total     int            `json:"total,omitempty"`
+	Percent   int            `json:"percent,omitempty"`
+	Error     string         `json:"error,omitempty"`
+	Started   time.Time      `json:"started"`
+	Finished  *time.Time     `json:"finished,omitempty"`
+	// Acknowledged is set once the operator has seen how a finished job went.
+	Acknowledged bool `json:"acknowledged"`
+
+	log    *logBuffer
+	cancel context.CancelFunc
+	// phase is the phase of the sequence timed for phaseDuration, since phaseStarted.
+	phase        string
+	phaseStarted time.Time
+}
+
+// Event returns the last event of the sequence the job went through.
+func (j *Job) Event() flash.Event {
+	return flash.Event{Device: j.Device, Step: j.Step, Partition: j.Partition,
+		Current: j.Current, Total: j.Total, Percent: j.Percent}
+}
+
+// Station keeps a list of the attached devices and runs jobs on them.
+type Station struct {
+	// Flasher is copied for every job, which gets its own Events and Stderr.
+	Flasher *flash.Flasher
+	// Poll is how often attached devices are listed.
+	Poll time.Duration
+	// Inventory, if set, records every job.
+	Inventory *inventory.Inventory
+	// RequireTag only lets devices with an asset tag be started.
+	RequireTag bool
+	// LogDir, if set, keeps the log of every job in a file, which hooks get.
+	LogDir string
+	// Timeout, in seconds, applies to jobs started without one, if set.
+	Timeout int
+	// Concurrency, if set, is how many jobs flash at the same time, the others waiting their turn.
+	Concurrency int
+
+	mu          sync.Mutex
+	slots       chan struct{}
+	devices     []*device.Device
+	jobs        []*Job
+	tags        map[string]string
+	subscribers map[chan struct{}]bool
+}
+
+func New(flasher *flash.Flasher) *Station {
+	return &Station{
+		Flasher:     flasher,
+		Poll:        2 * time.Second,
+		tags:        map[string]string{},
+		subscribers: map[chan struct{}]bool{},
+	}
+}
+
+// Run lists the attached devices every Poll until ctx is done. Devices are
+// only queried for their codename and bootloader state when they show up,
+// so that jobs running on them are left alone.
+func (s *Station) Run(ctx context.Context) error {
+	known := map[string]*device.Device{}
+	for {
+		attached, err := s.Flasher.Client.Attached(ctx)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		// Devices in fastboot mode are still listed when adb fails
+		if err == nil || len(attached) > 0 {
+			current := map[string]*device.Device{}
+			var devices []*device.Device
+			for _, d := range attached {
+				key := string(d.Mode) + " " + d.Serial
+				if k, ok := known[key]; ok {
+					d = k
+				} else if !s.running(d.Serial) {
+					s.Flasher.Client.Identify(ctx, d)
+				}
+				current[key] = d
+				devices = append(devices, d)
+			}
+			known = current
+			s.mu.Lock()
+			s.devices = devices
+			s.mu.Unlock()
+			attachedDevices.Set(float64(len(devices)))
+			s.notify()
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(s.Poll):
+		}
+	}
+}
+
+func (s *Station) running(serial string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, job := range s.jobs {
+		if job.Device.Serial == serial && job.State == Running {
+			return true
+		}
+	}
+	return false
+}
+
+// Devices returns the devices attached when they were last listed.
+func (s *Station) Devices() []*device.Device {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*device.Device(nil), s.devices...)
+}
+
+// Jobs returns a copy of every job, oldest first.
+func (s *Station) Jobs() []Job {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	jobs := make([]Job, 0, len(s.jobs))
+	for _, job := range s.jobs {
+		jobs = append(jobs, job.copy())
+	}
+	return jobs
+}
+
+// Job returns a copy of the job with id.
+func (s *Station) Job(id string) (Job, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if job := s.find(id); job != nil {
+		return job.copy(), true
+	}
+	return Job{}, false
+}
+
+// Log returns what the job with id has logged so far: its steps and the output of flash-all.
+func (s *Station) Log(id string) ([]byte, bool) {
+	s.mu.Lock()
+	job := s.find(id)
+	s.mu.Unlock()
+	if job == nil {
+		return nil, false
+	}
+	return job.log.Bytes(), true
+}
+
+func (s *Station) find(id string) *Job {
+	for _, job := range s.jobs {
+		if job.ID == id {
+			return job
+		}
+	}
+	return nil
+}
+
+func (j *Job) copy() Job {
+	c := *j
+	c.Actions = append([]flash.Action(nil), j.Actions...)
+	return c
+}
+
+// Options change how a job goes through the sequence.
+type Options struct {
+	// SkipLock leaves the bootloader unlocked after flashing.
+	SkipLock bool `json:"skip_lock,omitempty"`
+	// Timeout stops the job after that many seconds, if set.
+	Timeout int `json:"timeout,omitempty"`
+	// Operator is recorded in the inventory in place of the station's.
+	Operator string `json:"operator,omitempty"`
+	// AssetTag tags the device as SetTag does, once it is known to be attached
+	// and ready to start.
+	AssetTag string `json:"asset_tag,omitempty"`
+}
+
+// SetTag ties an asset tag, such as a scanned barcode, to the device with
+// serial for as long as the station runs. Jobs started afterwards carry it
+// into their log and inventory record.
+func (s *Station) SetTag(serial, tag string) error {
+	tag, err := checkTag(tag)
+	if err != nil {
+		return err
+	}
+	if serial == "" {
+		return errors.New("a serial number and an asset tag are needed")
+	}
+	s.mu.Lock()
+	s.tags[serial] = tag
+	s.notifyLocked()
+	s.mu.Unlock()
+	return nil
+}
+
+// checkTag returns tag without surrounding spaces, if it is a valid asset tag.
+func checkTag(tag string) (string, error) {
+	tag = strings.TrimSpace(tag)
+	if tag == "" {
+		return "", errors.New("a serial number and an asset tag are needed")
+	}
+	for _, r := range tag {
+		if unicode.IsControl(r) {
+			return "", fmt.Errorf("invalid asset tag %q", tag)
+		}
+	}
+	return tag, nil
+}
+
+// Tag returns the asset tag of the device with serial, if it has one.
+func (s *Station) Tag(serial string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.tags[serial]
+}
+
+// Start flashes the attached device with serial in the background.
+func (s *Station) Start(serial string, options Options) (Job, error) {
+	if options.AssetTag != "" {
+		tag, err := checkTag(options.AssetTag)
+		if err != nil {
+			return Job{}, err
+		}
+		options.AssetTag = tag
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var d *device.Device
+	for _, attached := range s.devices {
+		if attached.Serial == serial {
+			d = attached
+		}
+	}
+	if d == nil {
+		return Job{}, fmt.Errorf("%s is not attached", serial)
+	}
+	if _, ok := s.Flasher.Images[d.Codename]; !ok {
+		return Job{}, fmt.Errorf("no factory image for %s", d)
+	}
+	for _, job := range s.jobs {
+		if job.Device.Serial == serial && job.State == Running {
+			return Job{}, fmt.Errorf("%s is already being flashed", d)
+		}
+	}
+	if options.AssetTag != "" {
+		s.tags[serial] = options.AssetTag
+		s.notifyLocked()
+	}
+	tag := s.tags[serial]
+	if s.RequireTag && tag == "" {
+		return Job{}, fmt.Errorf("%s needs an asset tag", d)
+	}
+	if options.Timeout == 0 {
+		options.Timeout = s.Timeout
+	}
+	if s.slots == nil && s.Concurrency > 0 {
+		s.slots = make(chan struct{}, s.Concurrency)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	if options.Timeout > 0 {
+		ctx, cancel = context.WithTimeout(context.Background(), time.Duration(options.Timeout)*time.Second)
+	}
+	job := &Job{
+		ID:       strconv.Itoa(len(s.jobs) + 1),
+		Device:   &device.Device{Serial: d.Serial, Codename: d.Codename, Mode: d.Mode, Info: d.Info},
+		Options:  options,
+		AssetTag: tag,
+		State:    Running,
+		Started:  time.Now(),
+		log:      &logBuffer{},
+		cancel:   cancel,
+	}
+	s.jobs = append(s.jobs, job)
+	if s.LogDir != "" {
+		if err := job.log.create(filepath.Join(s.LogDir, job.Started.Format("20060102-150405")+"-"+d.Serial+".log")); err != nil {
+			fmt.Fprintln(job.log, "cannot keep the log in a file: "+err.Error())
+		}
+	}
+	if tag != "" {
+		fmt.Fprintln(job.log, job.Started.Format(time.RFC3339)+" asset tag "+tag)
+	}
+	flasher := *s.Flasher
+	flasher.Events = func(e flash.Event) { s.event(job, e) }
+	flasher.Stderr = job.log
+	flasher.SkipLock = options.SkipLock
+	flasher.LogPath = job.log.path
+	var entry *inventory.Entry
+	if s.Inventory != nil {
+		entry = s.Inventory.Begin(&flasher, job.Device)
+		if options.Operator != "" {
+			entry.Operator = options.Operator
+		}
+		entry.AssetTag = tag
+	}
+	run := flasher.Flash
+	if s.slots != nil {
+		run = func(ctx context.Context, d *device.Device) error {
+			select {
+			case s.slots <- struct{}{}:
+			default:
+				fmt.Fprintln(job.log, time.Now().Format(time.RFC3339)+" waiting for another job to finish")
+				select {
+				case s.slots <- struct{}{}:
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			}
+			defer func() { <-s.slots }()
+			return flasher.Flash(ctx, d)
+		}
+	}
+	go func() {
+		defer cancel()
+		// The sequence updates the device it works on, the job keeps it as it was attached
+		d := *job.Device
+		err := run(ctx, &d)
+		if errors.Is(err, context.DeadlineExceeded) {
+			err = fmt.Errorf("timed out after %d seconds: %w", options.Timeout, err)
+		}
+		if entry != nil {
+			if recordErr := entry.End(err); recordErr != nil {
+				fmt.Fprintln(job.log, "not recorded in the inventory: "+recordErr.Error())
+			}
+		}
+		s.finish(job, err)
+	}()
+	s.notifyLocked()
+	return job.copy(), nil
+}
+
+func (s *Station) event(job *Job, e flash.Event) {
+	line := time.Now().Format(time.RFC3339) + " " + string(e.Step)
+	if e.Action != flash.ActionNone {
+		line += " (" + string(e.Action) + ")"
+	}
+	if e.Partition != "" {
+		line += " " + e.Partition
+	}
+	fmt.Fprintln(job.log, line)
+	s.mu.Lock()
+	if phase := phaseOf(e.Step); phase != job.phase {
+		now := time.Now()
+		if job.phase != "" {
+			phaseDuration.Observe(now.Sub(job.phaseStarted).Seconds(), job.phase)
+		}
+		job.phase, job.phaseStarted = phase, now
+	}
+	job.Step, job.Partition, job.Current, job.Total, job.Percent = e.Step, e.Partition, e.Current, e.Total, e.Percent
+	switch {
+	case e.Action == flash.ActionReconnect:
+		// Reconnecting comes before the unlock confirmation asked for just before
+		job.Actions = append([]flash.Action{e.Action}, job.Actions...)
+	case e.Action != flash.ActionNone:
+		job.Actions = []flash.Action{e.Action}
+	default:
+		job.Actions = nil
+	}
+	s.notifyLocked()
+	s.mu.Unlock()
+}
+
+func (s *Station) finish(job *Job, err error) {
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	job.Finished, job.Actions = &now, nil
+	// The phase the job failed or was canceled in counts too
+	if job.phase != "" {
+		phaseDuration.Observe(now.Sub(job.phaseStarted).Seconds(), job.phase)
+		job.phase = ""
+	}
+	switch {
+	case err == nil:
+		job.State = Succeeded
+	case errors.Is(err, context.Canceled):
+		job.State, job.Error = Canceled, err.Error()
+	default:
+		job.State, job.Error = Failed, err.Error()
+		failures.Inc(category(job, err))
+	}
+	flashedDevices.Inc(job.Device.Codename, string(job.State))
+	fmt.Fprintln(job.log, strings.TrimSpace(now.Format(time.RFC3339)+" "+string(job.State)+" "+job.Error))
+	job.log.close()
+	s.notifyLocked()
+}
+
+// phaseOf names the phase of the sequence step belongs to, for phaseDuration.
+// Steps that are not timed belong to none.
+func phaseOf(step flash.Step) string {
+	switch step {
+	case flash.StepUnlock, flash.StepUnlockCritical:
+		return "unlock_wait"
+	case flash.StepFlash:
+		return "flash"
+	case flash.StepLock:
+		return "lock_wait"
+	}
+	return ""
+}
+
+// category sorts the error a job failed with by what failed, for failures.
+func category(job *Job, err error) string {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return "timeout"
+	}
+	var incompatible *factory.IncompatibleError
+	if errors.As(err, &incompatible) {
+		return "incompatible"
+	}
+	switch job.Step {
+	case "":
+		// Nothing was done on the device, such as when there is no image for it
+		return "setup"
+	case flash.StepUnlock, flash.StepUnlockCritical:
+		return "unlock"
+	case flash.StepFlash:
+		return "flash"
+	case flash.StepLock:
+		return "lock"
+	}
+	return "other"
+}
+
+// Cancel stops the job with id.
+func (s *Station) Cancel(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	job := s.find(id)
+	if job == nil {
+		return fmt.Errorf("no job %s", id)
+	}
+	job.cancel()
+	return nil
+}
+
+// Acknowledge records that the operator has seen how the job with id went.
+func (s *Station) Acknowledge(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	job := s.find(id)
+	if job == nil {
+		return fmt.Errorf("no job %s", id)
+	}
+	if job.State == Running {
+		return fmt.Errorf("job %s is still running", id)
+	}
+	job.Acknowledged = true
+	s.notifyLocked()
+	return nil
+}
+
+// Subscribe returns a channel that receives a value whenever devices or jobs
+// change, and a function to stop receiving them. Changes that come in while
+// the previous one was not received yet are merged.
+func (s *Station) Subscribe() (<-chan struct{}, func()) {
+	ch := make(chan struct{}, 1)
+	s.mu.Lock()
+	s.subscribers[ch] = true
+	s.mu.Unlock()
+	return ch, func() {
+		s.mu.Lock()
+		delete(s.subscribers, ch)
+		s.mu.Unlock()
+	}
+}
+
+func (s *Station) notify() {
+	s.mu.Lock()
+	s.notifyLocked()
+	s.mu.Unlock()
+}
+
+func (s *Station) notifyLocked() {
+	for ch := range s.subscribers {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// logBuffer collects the log of a job while it is being read, and copies it
+// to a file once create is called.
+type logBuffer struct {
+	mu   sync.Mutex
+	buf  bytes.Buffer
+	file *os.File
+	path string
+}
+
+func (l *logBuffer) create(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	l.mu.Lock()
+	l.file, l.path = file, path
+	_, err = file.Write(l.buf.Bytes())
+	l.mu.Unlock()
+	return err
+}
+
+func (l *logBuffer) close() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file != nil {
+		l.file.Close()
+		l.file = nil
+	}
+}
+
+func (l *logBuffer) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file != nil {
+		_, _ = l.file.Write(p)
+	}
+	return l.buf.Write(p)
+}
+
+func (l *logBuffer) Bytes() []byte {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]byte(nil), l.buf.Bytes()...)
+}
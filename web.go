@@ -0,0 +1,460 @@
+// Copyright 2020 CIS Maxwell, LLC. All rights reserved.
+// Copyright 2020 The Calyx Institute
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"gitlab.com/calyxos/device-flasher/flash"
+	"gitlab.com/calyxos/device-flasher/internal/metrics"
+	"gitlab.com/calyxos/device-flasher/inventory"
+	"gitlab.com/calyxos/device-flasher/station"
+)
+
+// serveStation serves a page at addr from which the operator starts flashing
+// each device as it gets attached, in place of the prompts on the console,
+// along with the API under /api/. Every request needs the token, if set: the
+// printed address carries it for the browser.
+// Jobs are recorded in inv. With -require-tag, devices need an asset tag to start.
+func serveStation(o *options, addr string, flasher *flash.Flasher, inv *inventory.Inventory) {
+	token := o.apiToken()
+	listener, err := listen(addr)
+	if err != nil {
+		errorln(err, true)
+	}
+	w := &web{station: station.New(flasher), loopback: isLoopback(listener.Addr()), token: token}
+	w.station.Inventory = inv
+	w.station.RequireTag = o.requireTag
+	w.station.LogDir = logsDir()
+	w.station.Timeout = o.settings.Timeouts.Device
+	w.station.Concurrency = o.concurrency
+	if !w.loopback && token == "" {
+		warnln(tr("Anyone who can reach %s can flash the attached devices, consider setting a token", listener.Addr()))
+	}
+	go func() { _ = w.station.Run(context.Background()) }()
+	address := listener.Addr().String()
+	if token != "" {
+		address += "/?token=" + url.QueryEscape(token)
+	}
+	fmt.Println(tr("Open http://%s in a browser to start flashing", address))
+	if err := http.Serve(listener, w.handler()); err != nil {
+		errorln(err, true)
+	}
+}
+
+// listen binds to addr, on the loopback interface unless addr names a host:
+// ":8080" is only reachable from this computer, "0.0.0.0:8080" from anywhere.
+func listen(addr string) (net.Listener, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	if host == "" {
+		host = "127.0.0.1"
+	}
+	return net.Listen("tcp", net.JoinHostPort(host, port))
+}
+
+func isLoopback(addr net.Addr) bool {
+	tcp, ok := addr.(*net.TCPAddr)
+	return ok && tcp.IP.IsLoopback()
+}
+
+type web struct {
+	station  *station.Station
+	loopback bool
+	token    string
+
+	mu sync.Mutex
+	// acknowledged is set once the operator went through the instructions.
+	acknowledged bool
+}
+
+func (w *web) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", w.page)
+	mux.HandleFunc("/events", w.events)
+	mux.HandleFunc("/start", w.post(func(r *http.Request) error {
+		_, err := w.station.Start(r.FormValue("serial"), station.Options{})
+		return err
+	}))
+	mux.HandleFunc("/acknowledge", w.post(func(r *http.Request) error {
+		if job := r.FormValue("job"); job != "" {
+			return w.station.Acknowledge(job)
+		}
+		w.mu.Lock()
+		w.acknowledged = true
+		w.mu.Unlock()
+		return nil
+	}))
+	mux.HandleFunc("/tag", w.post(func(r *http.Request) error {
+		return w.station.SetTag(r.FormValue("serial"), r.FormValue("tag"))
+	}))
+	mux.HandleFunc("/cancel", w.post(func(r *http.Request) error {
+		return w.station.Cancel(r.FormValue("job"))
+	}))
+	mux.Handle("/api/", w.api())
+	mux.Handle("/metrics", metrics.Default)
+	return w.guard(w.authorize(mux))
+}
+
+// guard turns away requests that other sites make through the operator's
+// browser: by name, if the dashboard is only reachable from this computer,
+// and from their own pages.
+func (w *web) guard(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		host, _, err := net.SplitHostPort(r.Host)
+		if err != nil {
+			host = r.Host
+		}
+		if w.loopback && host != "localhost" && net.ParseIP(host) == nil {
+			http.Error(rw, "forbidden", http.StatusForbidden)
+			return
+		}
+		if origin := r.Header.Get("Origin"); origin != "" && origin != "http://"+r.Host {
+			http.Error(rw, "forbidden", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(rw, r)
+	})
+}
+
+// post handles a button of the page.
+func (w *web) post(fn func(r *http.Request) error) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(rw, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if err := fn(r); err != nil {
+			http.Error(rw, err.Error(), http.StatusBadRequest)
+			return
+		}
+		rw.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// events streams the state of the station as Server-Sent Events, on every
+// change and every second for the elapsed times.
+func (w *web) events(rw http.ResponseWriter, r *http.Request) {
+	flusher, ok := rw.(http.Flusher)
+	if !ok {
+		http.Error(rw, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	rw.Header().Set("Content-Type", "text/event-stream")
+	rw.Header().Set("Cache-Control", "no-cache")
+	changed, unsubscribe := w.station.Subscribe()
+	defer unsubscribe()
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		state, err := json.Marshal(w.state())
+		if err != nil {
+			return
+		}
+		fmt.Fprintf(rw, "data: %s\n\n", state)
+		flusher.Flush()
+		select {
+		case <-r.Context().Done():
+			return
+		case <-changed:
+		case <-ticker.C:
+		}
+	}
+}
+
+// webState is what the page shows, with the texts already translated.
+type webState struct {
+	Acknowledged bool     `json:"acknowledged"`
+	RequireTag   bool     `json:"require_tag"`
+	Images       []string `json:"images"`
+	Devices      []webRow `json:"devices"`
+}
+
+type webRow struct {
+	Serial   string   `json:"serial"`
+	Codename string   `json:"codename"`
+	Tag      string   `json:"tag,omitempty"`
+	Image    string   `json:"image,omitempty"`
+	Attached bool     `json:"attached"`
+	Job      string   `json:"job,omitempty"`
+	State    string   `json:"state,omitempty"`
+	Phase    string   `json:"phase"`
+	Progress float64  `json:"progress"`
+	Elapsed  string   `json:"elapsed,omitempty"`
+	Actions  []string `json:"actions,omitempty"`
+	Error    string   `json:"error,omitempty"`
+}
+
+// state lists the jobs the operator has not acknowledged yet, followed by the
+// other attached devices.
+func (w *web) state() webState {
+	w.mu.Lock()
+	state := webState{Acknowledged: w.acknowledged, RequireTag: w.station.RequireTag, Images: []string{}, Devices: []webRow{}}
+	w.mu.Unlock()
+	images := w.station.Flasher.Images
+	for _, folder := range images {
+		state.Images = append(state.Images, filepath.Base(folder))
+	}
+	sort.Strings(state.Images)
+	rows := map[string]int{}
+	for _, job := range w.station.Jobs() {
+		if job.Acknowledged {
+			continue
+		}
+		row := webRow{Serial: job.Device.Serial, Codename: job.Device.Codename, Tag: job.AssetTag, Job: job.ID, State: string(job.State), Error: job.Error}
+		if row.Tag == "" {
+			row.Tag = w.station.Tag(row.Serial)
+		}
+		row.Phase, row.Progress = describe(job.Event())
+		finished := time.Now()
+		if job.Finished != nil {
+			finished = *job.Finished
+		}
+		row.Elapsed = elapsed(finished.Sub(job.Started))
+		key := w.station.Flasher.Client.Profile(job.Device.Codename).ReconnectKey
+		for _, action := range job.Actions {
+			row.Actions = append(row.Actions, instructions(job.Device, action, key)...)
+		}
+		switch job.State {
+		case station.Failed:
+			row.Phase, row.Progress = tr("Failed"), -1
+		case station.Canceled:
+			row.Phase, row.Progress = tr("Canceled"), -1
+		}
+		if i, ok := rows[row.Serial]; ok {
+			state.Devices[i] = row
+			continue
+		}
+		rows[row.Serial] = len(state.Devices)
+		state.Devices = append(state.Devices, row)
+	}
+	for _, d := range w.station.Devices() {
+		image := ""
+		if folder, ok := images[d.Codename]; ok {
+			image = filepath.Base(folder)
+		}
+		if i, ok := rows[d.Serial]; ok {
+			state.Devices[i].Attached = true
+			state.Devices[i].Image = image
+			continue
+		}
+		row := webRow{Serial: d.Serial, Codename: d.Codename, Tag: w.station.Tag(d.Serial), Image: image, Attached: true, Phase: tr("Waiting"), Progress: -1}
+		if image == "" {
+			row.Phase = tr("No matching image found")
+		}
+		rows[d.Serial] = len(state.Devices)
+		state.Devices = append(state.Devices, row)
+	}
+	return state
+}
+
+func (w *web) page(rw http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(rw, r)
+		return
+	}
+	data := struct {
+		Title        string
+		Instructions []string
+		Labels       map[string]string
+	}{
+		Title: tr("Android Factory Image Flasher version %s", version),
+		Instructions: []string{
+			tr("Connect to a Wi-Fi network and ensure that no SIM cards are installed"),
+			tr("Enable Developer Options on device (Settings -> About Phone -> tap \"Build number\" 7 times)"),
+			tr("Enable OEM Unlocking (Settings -> System -> Advanced -> Developer Options)"),
+			tr("Disconnect the USB cable from your device"),
+			tr("Power off your device"),
+			tr("Hold volume down and connect the cable to boot it into fastboot mode."),
+		},
+		Labels: map[string]string{
+			"continue":    tr("Continue"),
+			"images":      tr("Factory images"),
+			"codename":    tr("CODENAME"),
+			"serial":      tr("SERIAL"),
+			"tag":         tr("ASSET TAG"),
+			"scan":        tr("Scan or type the asset tag"),
+			"phase":       tr("PHASE"),
+			"progress":    tr("PROGRESS"),
+			"elapsed":     tr("ELAPSED"),
+			"action":      tr("ACTION REQUIRED ON THE PHONE"),
+			"start":       tr("Start"),
+			"cancel":      tr("Cancel"),
+			"acknowledge": tr("Acknowledge"),
+			"none":        tr("No devices detected"),
+		},
+	}
+	rw.Header().Set("Content-Type", "text/html; charset=utf-8")
+	_ = webPage.Execute(rw, data)
+}
+
+var webPage = template.Must(template.New("dashboard").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; width: 100%; }
+th, td { text-align: left; padding: .4em .8em; border-bottom: 1px solid #ddd; vertical-align: top; }
+progress { width: 12em; }
+button { font-size: 1em; padding: .3em 1em; }
+.action { background: #fc0; font-weight: bold; padding: .1em .4em; }
+.failed, .canceled { color: #c00; }
+input { font-size: 1em; }
+.succeeded { color: #03c; }
+#instructions.done { display: none; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<div id="instructions">
+<ol>{{range .Instructions}}<li>{{.}}</li>{{end}}</ol>
+<button onclick="post('/acknowledge', {})">{{.Labels.continue}}</button>
+</div>
+<h2>{{.Labels.images}}</h2>
+<ul id="images"></ul>
+<table>
+<thead><tr><th>{{.Labels.codename}}</th><th>{{.Labels.serial}}</th><th>{{.Labels.tag}}</th><th>{{.Labels.phase}}</th><th>{{.Labels.progress}}</th><th>{{.Labels.elapsed}}</th><th></th></tr></thead>
+<tbody id="devices"></tbody>
+</table>
+<p id="none">{{.Labels.none}}</p>
+<script>
+const labels = {{.Labels}};
+
+function post(path, params) {
+  fetch(path, {method: 'POST', body: new URLSearchParams(params)})
+    .then(r => r.ok ? null : r.text().then(alert));
+}
+
+function button(td, label, path, params, disabled) {
+  const b = document.createElement('button');
+  b.textContent = label;
+  b.disabled = disabled;
+  b.onclick = () => post(path, params);
+  td.appendChild(b);
+}
+
+// Rows are kept by serial number and updated in place, so that an asset tag
+// being typed or scanned into one is not lost when the next update comes in.
+const rows = {};
+
+function newRow(serial) {
+  const tr = document.createElement('tr');
+  const row = {tr: tr, cells: [0, 1, 2, 3, 4, 5, 6].map(() => tr.insertCell())};
+  row.tag = document.createElement('span');
+  row.input = document.createElement('input');
+  row.input.placeholder = labels.scan;
+  row.input.dataset.serial = serial;
+  // Barcode scanners type the tag followed by Enter
+  row.input.onkeydown = e => {
+    if (e.key === 'Enter' && row.input.value.trim() !== '') {
+      post('/tag', {serial: serial, tag: row.input.value});
+      row.input.value = '';
+      row.input.blur();
+    }
+  };
+  row.cells[2].append(row.tag, row.input);
+  return row;
+}
+
+function update(row, d, state) {
+  const [codename, serial, tag, phase, progress, elapsed, buttons] = row.cells;
+  codename.textContent = d.codename;
+  serial.textContent = d.serial;
+  row.tag.textContent = d.tag || '';
+  row.input.style.display = d.tag || d.state === 'running' ? 'none' : '';
+  phase.replaceChildren(d.phase);
+  phase.className = d.state || '';
+  if (d.error) {
+    phase.append(document.createElement('br'), d.error);
+  }
+  for (const action of d.actions || []) {
+    const p = document.createElement('p');
+    const marker = document.createElement('span');
+    marker.className = 'action';
+    marker.textContent = labels.action;
+    p.append(marker, ' ', action);
+    phase.appendChild(p);
+  }
+  progress.replaceChildren();
+  if (d.progress >= 0) {
+    const bar = document.createElement('progress');
+    bar.value = d.progress;
+    progress.appendChild(bar);
+  }
+  elapsed.textContent = d.elapsed || '';
+  buttons.replaceChildren();
+  if (d.state === 'running') {
+    button(buttons, labels.cancel, '/cancel', {job: d.job});
+  } else if (d.job) {
+    button(buttons, labels.acknowledge, '/acknowledge', {job: d.job});
+  } else if (d.attached && d.image && state.acknowledged) {
+    button(buttons, labels.start, '/start', {serial: d.serial}, state.require_tag && !d.tag);
+  }
+}
+
+function render(state) {
+  document.getElementById('instructions').className = state.acknowledged ? 'done' : '';
+  const images = document.getElementById('images');
+  images.replaceChildren(...state.images.map(name => {
+    const li = document.createElement('li');
+    li.textContent = name;
+    return li;
+  }));
+  document.getElementById('none').style.display = state.devices.length === 0 ? '' : 'none';
+  const devices = document.getElementById('devices');
+  const seen = {};
+  state.devices.forEach((d, i) => {
+    const row = rows[d.serial] || (rows[d.serial] = newRow(d.serial));
+    seen[d.serial] = true;
+    if (devices.children[i] !== row.tr) {
+      devices.insertBefore(row.tr, devices.children[i] || null);
+    }
+    update(row, d, state);
+  });
+  for (const serial in rows) {
+    if (!seen[serial]) {
+      rows[serial].tr.remove();
+      delete rows[serial];
+    }
+  }
+  // Have the scanner type into the first device missing a tag
+  if (!document.activeElement || document.activeElement === document.body) {
+    const untagged = state.devices.find(d => !d.tag && d.attached && d.state !== 'running');
+    if (untagged) {
+      rows[untagged.serial].input.focus();
+    }
+  }
+}
+
+new EventSource('/events').onmessage = e => render(JSON.parse(e.data));
+</script>
+</body>
+</html>
+`))
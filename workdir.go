@@ -0,0 +1,89 @@
+// Copyright 2020 CIS Maxwell, LLC. All rights reserved.
+// Copyright 2020 The Calyx Institute
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+)
+
+// workdir holds everything the flasher writes, from the workdir flag or
+// setting. When it is empty, downloads and extractions go to the cache folder
+// of the user, and logs and state to its data folder. The images folders are
+// set apart from it.
+var workdir string
+
+// cacheHome returns the folder of downloads and extractions.
+func cacheHome() string {
+	if workdir != "" {
+		return workdir
+	}
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return cwd
+	}
+	return filepath.Join(dir, "device-flasher")
+}
+
+// dataHome returns the folder of logs and state.
+func dataHome() string {
+	if workdir != "" {
+		return workdir
+	}
+	dir, err := userDataDir()
+	if err != nil {
+		return cwd
+	}
+	return filepath.Join(dir, "device-flasher")
+}
+
+// userDataDir returns $XDG_DATA_HOME or ~/.local/share on Unix, the
+// configuration folder of the user on Windows and macOS.
+func userDataDir() (string, error) {
+	switch runtime.GOOS {
+	case "windows", "darwin", "ios":
+		return os.UserConfigDir()
+	}
+	if dir := os.Getenv("XDG_DATA_HOME"); dir != "" {
+		return dir, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".local", "share"), nil
+}
+
+// downloadsDir returns where the platform tools zip is downloaded.
+func downloadsDir() string {
+	return filepath.Join(cacheHome(), "downloads")
+}
+
+// cacheDir returns where extracted zips are kept, see cache.
+func cacheDir() string {
+	return filepath.Join(cacheHome(), "extracted")
+}
+
+// logsDir returns where station mode and the dashboard keep the log of each device.
+func logsDir() string {
+	return filepath.Join(dataHome(), "logs")
+}
+
+// errorLog returns the log of the errors and flash-all output of the last run.
+func errorLog() string {
+	return filepath.Join(dataHome(), "error.log")
+}